@@ -0,0 +1,289 @@
+package trama
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binder is an interceptor decoding the request into the fields of a struct,
+// usually the freshly constructed handler itself, before the handler method
+// is called. The fields are chosen by their tags:
+//
+//	type handler struct {
+//		trama.NopHandler
+//		Page   int      `query:"page"`
+//		Name   string   `form:"name"`
+//		Tags   []string `query:"tag"`
+//		ID     int64    `path:"id"`
+//		Domain Domain   `json:"body"`
+//	}
+//
+//	func (h *handler) Interceptors() trama.InterceptorChain {
+//		return trama.NewInterceptorChain(trama.NewBinder(h))
+//	}
+//
+// A field tagged with query, form or path receives the value of the named
+// query string parameter, form field (of a URL-encoded or multipart body) or
+// path parameter (see Mux’s Register method). Strings, booleans, numbers,
+// time.Duration, encoding.TextUnmarshaler implementations and pointers to
+// them are supported, along with slices of them, which receive every value of
+// a parameter. A field whose parameter is absent is left untouched. The
+// field tagged json:"body" receives the JSON body of the request, unless it is
+// a form; a body of another media type is rejected with a 415 (Unsupported
+// Media Type) HTTPError. A value that can’t be converted to the type of its
+// field interrupts the chain with a 400 (Bad Request) HTTPError.
+type Binder struct {
+	NopInterceptor
+	target interface{}
+}
+
+// NewBinder creates a Binder decoding the requests into target, which must be
+// a pointer to a struct.
+func NewBinder(target interface{}) *Binder {
+	return &Binder{target: target}
+}
+
+// Before binds the request to the target.
+func (b *Binder) Before(res Response, r *http.Request) error {
+	return Bind(r, b.target)
+}
+
+// Bind decodes the request into the tagged fields of target, which must be a
+// pointer to a struct, as the Binder interceptor does.
+func Bind(r *http.Request, target interface{}) error {
+	value := reflect.ValueOf(target)
+
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Can’t bind the request to a %T; a pointer to a struct is expected", target)
+	}
+
+	return bindStruct(r, value.Elem())
+}
+
+func bindStruct(r *http.Request, value reflect.Value) error {
+	typ := value.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindStruct(r, value.Field(i)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if field.Tag.Get("json") == "body" {
+			if err := bindBody(r, value.Field(i)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, source := range []string{"query", "form", "path"} {
+			name := field.Tag.Get(source)
+
+			if name == "" {
+				continue
+			}
+
+			values, err := requestValues(r, source, name)
+
+			if err != nil {
+				return NewHTTPError(http.StatusBadRequest, "", err)
+			}
+
+			if len(values) == 0 {
+				continue
+			}
+
+			err = setValues(value.Field(i), values)
+
+			if _, ok := err.(unsupportedTypeError); ok {
+				return err
+			}
+
+			if err != nil {
+				message := fmt.Sprintf("Invalid value “%s” for the parameter “%s”", strings.Join(values, ", "), name)
+				return NewHTTPError(http.StatusBadRequest, message, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// requestValues returns the values of the named parameter from the source.
+func requestValues(r *http.Request, source, name string) ([]string, error) {
+	switch source {
+	case "query":
+		return r.URL.Query()[name], nil
+	case "form":
+		if r.PostForm == nil {
+			err := r.ParseMultipartForm(32 << 20)
+
+			if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+				return nil, err
+			}
+		}
+
+		return r.PostForm[name], nil
+	}
+
+	if value, found := PathParams(r)[name]; found {
+		return []string{value}, nil
+	}
+
+	return nil, nil
+}
+
+// bindBody decodes the JSON body of the request into the field.
+func bindBody(r *http.Request, field reflect.Value) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+
+		// A form body is bound to the fields tagged with form.
+		if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+			return nil
+		}
+
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			return NewHTTPError(http.StatusUnsupportedMediaType, "", nil)
+		}
+	}
+
+	err := json.NewDecoder(r.Body).Decode(field.Addr().Interface())
+
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return NewHTTPError(http.StatusBadRequest, "Invalid JSON body", err)
+	}
+
+	return nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setValues converts the values to the type of the field, which receives all
+// of them if it is a slice or the first one otherwise.
+func setValues(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+		return nil
+	}
+
+	return setValue(field, values[0])
+}
+
+// setValue converts the value to the type of the field.
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		pointer := reflect.New(field.Type().Elem())
+
+		if err := setValue(pointer.Elem(), value); err != nil {
+			return err
+		}
+
+		field.Set(pointer)
+		return nil
+	}
+
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	default:
+		return unsupportedTypeError{field.Type()}
+	}
+
+	return nil
+}
+
+// unsupportedTypeError is the error of a field whose type can’t be bound,
+// which is a mistake of the handler, not of the request.
+type unsupportedTypeError struct {
+	typ reflect.Type
+}
+
+func (u unsupportedTypeError) Error() string {
+	return fmt.Sprintf("Can’t bind a request parameter to the type %s", u.typ)
+}
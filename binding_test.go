@@ -0,0 +1,176 @@
+package trama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindHandler struct {
+	NopHandler
+	Page     int           `query:"page"`
+	Tags     []string      `query:"tag"`
+	Limit    *uint8        `query:"limit"`
+	Timeout  time.Duration `query:"timeout"`
+	Exact    bool          `query:"exact"`
+	Name     string        `form:"name"`
+	Score    float64       `form:"score"`
+	ID       int64         `path:"id"`
+	Body     poem          `json:"body"`
+	Since    time.Time     `query:"since"`
+	internal string        `query:"internal"`
+}
+
+func (h *bindHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(NewBinder(h))
+}
+
+func (h *bindHandler) Get(res Response, req *http.Request) error {
+	res.WriteJSON(http.StatusOK, h)
+	return nil
+}
+
+func (h *bindHandler) Post(res Response, req *http.Request) error {
+	return h.Get(res, req)
+}
+
+func TestBinder(t *testing.T) {
+	limit := uint8(10)
+
+	data := []struct {
+		description     string
+		method          string
+		url             string
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedHandler bindHandler
+	}{
+		{
+			description:    "It should bind the query string parameters",
+			method:         "GET",
+			url:            "/poems/7?page=2&tag=modernismo&tag=soneto&limit=10&timeout=1m30s&exact=true&since=1922-02-13T20:00:00Z&internal=x",
+			expectedStatus: http.StatusOK,
+			expectedHandler: bindHandler{
+				Page:    2,
+				Tags:    []string{"modernismo", "soneto"},
+				Limit:   &limit,
+				Timeout: 90 * time.Second,
+				Exact:   true,
+				ID:      7,
+				Since:   time.Date(1922, 2, 13, 20, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			description:    "It should bind the form fields",
+			method:         "POST",
+			url:            "/poems/7",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "name=Manuel+Bandeira&score=9.5",
+			expectedStatus: http.StatusOK,
+			expectedHandler: bindHandler{
+				Name:  "Manuel Bandeira",
+				Score: 9.5,
+				ID:    7,
+			},
+		},
+		{
+			description:    "It should bind the JSON body",
+			method:         "POST",
+			url:            "/poems/7",
+			contentType:    "application/json; charset=utf-8",
+			body:           `{"Title": "Pneumotórax"}`,
+			expectedStatus: http.StatusOK,
+			expectedHandler: bindHandler{
+				ID:   7,
+				Body: poem{Title: "Pneumotórax"},
+			},
+		},
+		{
+			description:    "It should reject an invalid number",
+			method:         "GET",
+			url:            "/poems/7?page=dois",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "It should reject a number out of range",
+			method:         "GET",
+			url:            "/poems/7?limit=256",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "It should reject an invalid JSON body",
+			method:         "POST",
+			url:            "/poems/7",
+			contentType:    "application/json",
+			body:           `{"Title": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "It should reject a body that isn’t JSON",
+			method:         "POST",
+			url:            "/poems/7",
+			contentType:    "text/plain",
+			body:           "Febre, hemoptise, dispneia e suores noturnos.",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for i, item := range data {
+		handler := &bindHandler{}
+
+		mux := NewMux()
+		mux.Register("/poems/{id}", func() Handler { return handler })
+
+		r, err := http.NewRequest(item.method, item.url, strings.NewReader(item.body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.contentType != "" {
+			r.Header.Set("Content-Type", item.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+			continue
+		}
+
+		if item.expectedStatus != http.StatusOK {
+			continue
+		}
+
+		if !reflect.DeepEqual(*handler, item.expectedHandler) {
+			t.Errorf("Item %d, “%s”, wrong handler fields. Expecting “%+v”; found “%+v”", i, item.description, item.expectedHandler, *handler)
+		}
+	}
+}
+
+func TestBindUnsupportedType(t *testing.T) {
+	var target struct {
+		Channel chan int `query:"channel"`
+	}
+
+	r, err := http.NewRequest("GET", "/?channel=1", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Bind(r, &target)
+
+	if _, ok := err.(unsupportedTypeError); !ok {
+		t.Errorf("Unexpected error. Expecting an unsupported type error; found “%v”", err)
+	}
+
+	if err := Bind(r, target); err == nil {
+		t.Error("Expecting an error when binding to a struct that isn’t a pointer")
+	}
+}
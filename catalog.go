@@ -0,0 +1,639 @@
+package trama
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Catalog holds the translations of the messages of a language, so that a
+// single template file can serve every language. The catalog of a
+// TemplateGroup is available to its templates through the functions T and N:
+//
+//	<h1>{{T "Weaving the morning"}}</h1>
+//	<p>{{N "%d rooster" "%d roosters" .Count .Count}}</p>
+//
+// T translates a message and N chooses the plural form of a message for a
+// count, following the plural rule of the catalog’s language. The remaining
+// arguments of both functions, if any, are interpolated in the translation
+// with fmt.Sprintf. A message not found in the catalog is looked for in the
+// catalogs of the group’s fallbacks and, if it isn’t found anywhere, the
+// message itself is used, with the English plural rule.
+type Catalog struct {
+	messages map[string][]string
+	plural   pluralRule
+}
+
+type pluralRule struct {
+	forms int
+	index func(n int) int
+}
+
+// englishPlural is the plural rule used when a catalog doesn’t specify one.
+var englishPlural = pluralRule{
+	forms: 2,
+	index: func(n int) int {
+		if n != 1 {
+			return 1
+		}
+
+		return 0
+	},
+}
+
+func newCatalog() *Catalog {
+	return &Catalog{messages: make(map[string][]string), plural: englishPlural}
+}
+
+// LoadJSONCatalog reads a catalog in JSON format, where each message is
+// translated either to a string or, for the messages with plural forms, to a
+// list of strings ordered as in the plural rule, in the syntax of gettext’s
+// Plural-Forms header:
+//
+//	{
+//		"plural_forms": "nplurals=2; plural=(n > 1);",
+//		"messages": {
+//			"Weaving the morning": "Tecendo a manhã",
+//			"%d rooster": ["%d galo", "%d galos"]
+//		}
+//	}
+func LoadJSONCatalog(r io.Reader) (*Catalog, error) {
+	var content struct {
+		PluralForms string                     `json:"plural_forms"`
+		Messages    map[string]json.RawMessage `json:"messages"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&content); err != nil {
+		return nil, err
+	}
+
+	catalog := newCatalog()
+
+	if content.PluralForms != "" {
+		plural, err := parsePluralForms(content.PluralForms)
+
+		if err != nil {
+			return nil, err
+		}
+
+		catalog.plural = plural
+	}
+
+	for id, raw := range content.Messages {
+		var forms []string
+
+		if err := json.Unmarshal(raw, &forms); err != nil {
+			var translation string
+
+			if err := json.Unmarshal(raw, &translation); err != nil {
+				return nil, fmt.Errorf("The translation of “%s” must be a string or a list of strings", id)
+			}
+
+			forms = []string{translation}
+		}
+
+		catalog.messages[id] = forms
+	}
+
+	return catalog, nil
+}
+
+// LoadPOCatalog reads a catalog in the PO format of gettext. The plural rule
+// is read from the Plural-Forms field of the header entry. Fuzzy entries,
+// untranslated entries and entries with a context (msgctxt) are ignored.
+func LoadPOCatalog(r io.Reader) (*Catalog, error) {
+	catalog := newCatalog()
+	scanner := bufio.NewScanner(r)
+
+	var entry poEntry
+	var current *string
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case text == "":
+			if err := entry.add(catalog); err != nil {
+				return nil, err
+			}
+
+			entry, current = poEntry{}, nil
+			continue
+
+		case strings.HasPrefix(text, "#"):
+			if strings.HasPrefix(text, "#,") && strings.Contains(text, "fuzzy") {
+				entry.fuzzy = true
+			}
+
+			continue
+
+		case strings.HasPrefix(text, `"`):
+			if current == nil {
+				return nil, fmt.Errorf("Unexpected string in the PO catalog at line %d", line)
+			}
+
+			value, err := strconv.Unquote(text)
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid string in the PO catalog at line %d", line)
+			}
+
+			*current += value
+			continue
+		}
+
+		k := strings.Index(text, " ")
+
+		if k < 0 {
+			return nil, fmt.Errorf("Invalid line in the PO catalog at line %d", line)
+		}
+
+		keyword, rest := text[:k], strings.TrimSpace(text[k:])
+		value, err := strconv.Unquote(rest)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid string in the PO catalog at line %d", line)
+		}
+
+		if (keyword == "msgctxt" || keyword == "msgid") && entry.translated {
+			// An entry without a blank line before it.
+			if err := entry.add(catalog); err != nil {
+				return nil, err
+			}
+
+			entry = poEntry{}
+		}
+
+		switch {
+		case keyword == "msgctxt":
+			entry.context = true
+			current = new(string)
+		case keyword == "msgid":
+			current = &entry.id
+		case keyword == "msgid_plural":
+			current = &entry.idPlural
+		case keyword == "msgstr":
+			entry.forms = append(entry.forms, "")
+			current = &entry.forms[0]
+			entry.translated = true
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			index, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+
+			if err != nil || index != len(entry.forms) {
+				return nil, fmt.Errorf("Invalid plural form in the PO catalog at line %d", line)
+			}
+
+			entry.forms = append(entry.forms, "")
+			current = &entry.forms[index]
+			entry.translated = true
+		default:
+			return nil, fmt.Errorf("Unknown keyword “%s” in the PO catalog at line %d", keyword, line)
+		}
+
+		*current = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := entry.add(catalog); err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+type poEntry struct {
+	id, idPlural string
+	forms        []string
+	context      bool
+	fuzzy        bool
+	translated   bool
+}
+
+func (e poEntry) add(catalog *Catalog) error {
+	if !e.translated || e.context {
+		return nil
+	}
+
+	if e.id == "" {
+		return catalog.readHeader(e.forms[0])
+	}
+
+	if e.fuzzy {
+		return nil
+	}
+
+	for _, form := range e.forms {
+		if form == "" {
+			return nil
+		}
+	}
+
+	catalog.messages[e.id] = e.forms
+	return nil
+}
+
+func (c *Catalog) readHeader(header string) error {
+	for _, field := range strings.Split(header, "\n") {
+		k := strings.Index(field, ":")
+
+		if k < 0 || !strings.EqualFold(strings.TrimSpace(field[:k]), "Plural-Forms") {
+			continue
+		}
+
+		plural, err := parsePluralForms(field[k+1:])
+
+		if err != nil {
+			return err
+		}
+
+		c.plural = plural
+	}
+
+	return nil
+}
+
+// message returns the translation of the message for the count, if any.
+func (c *Catalog) message(id string, n int) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	forms, found := c.messages[id]
+
+	if !found || len(forms) == 0 {
+		return "", false
+	}
+
+	index := c.plural.index(n)
+
+	if index < 0 || index >= len(forms) {
+		index = 0
+	}
+
+	return forms[index], true
+}
+
+// catalogFuncs returns the functions T and N translating the messages with
+// the first of the catalogs having them.
+func catalogFuncs(catalogs []*Catalog) template.FuncMap {
+	translate := func(id, plural string, n int, args []interface{}) string {
+		message, found := "", false
+
+		for _, catalog := range catalogs {
+			if message, found = catalog.message(id, n); found {
+				break
+			}
+		}
+
+		if !found {
+			message = id
+
+			if englishPlural.index(n) == 1 && plural != "" {
+				message = plural
+			}
+		}
+
+		if len(args) == 0 {
+			return message
+		}
+
+		return fmt.Sprintf(message, args...)
+	}
+
+	return template.FuncMap{
+		"T": func(id string, args ...interface{}) string {
+			return translate(id, "", 1, args)
+		},
+		"N": func(singular, plural string, count interface{}, args ...interface{}) (string, error) {
+			n, err := toInt(count)
+
+			if err != nil {
+				return "", err
+			}
+
+			return translate(singular, plural, n, args), nil
+		},
+	}
+}
+
+// toInt converts a value of any integer type, as found in the data of the
+// templates, to an int.
+func toInt(value interface{}) (int, error) {
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(v.Uint()), nil
+	}
+
+	return 0, fmt.Errorf("The count “%v” is not an integer", value)
+}
+
+// parsePluralForms parses a plural rule in the syntax of gettext’s
+// Plural-Forms header, such as “nplurals=2; plural=(n != 1);”.
+func parsePluralForms(header string) (pluralRule, error) {
+	var rule pluralRule
+
+	for _, field := range strings.Split(header, ";") {
+		k := strings.Index(field, "=")
+
+		if k < 0 {
+			continue
+		}
+
+		name, value := strings.TrimSpace(field[:k]), strings.TrimSpace(field[k+1:])
+
+		switch name {
+		case "nplurals":
+			forms, err := strconv.Atoi(value)
+
+			if err != nil || forms < 1 {
+				return rule, fmt.Errorf("Invalid number of plural forms “%s”", value)
+			}
+
+			rule.forms = forms
+		case "plural":
+			index, err := parsePluralExpr(value)
+
+			if err != nil {
+				return rule, err
+			}
+
+			rule.index = index
+		}
+	}
+
+	if rule.forms == 0 || rule.index == nil {
+		return rule, fmt.Errorf("Incomplete plural forms “%s”", strings.TrimSpace(header))
+	}
+
+	return rule, nil
+}
+
+// parsePluralExpr compiles the C expression of a plural rule, where n is the
+// count, into a function.
+func parsePluralExpr(expr string) (func(int) int, error) {
+	p := &pluralParser{expr: expr}
+	f, err := p.ternary()
+
+	if err == nil {
+		p.skipSpaces()
+
+		if p.pos < len(p.expr) {
+			err = p.errorf("unexpected “%s”", p.expr[p.pos:])
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// pluralParser is a recursive descent parser for the expressions of plural
+// rules, with the precedence of the C operators.
+type pluralParser struct {
+	expr string
+	pos  int
+}
+
+func (p *pluralParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid plural expression “%s”: %s", p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *pluralParser) skipSpaces() {
+	for p.pos < len(p.expr) && strings.ContainsRune(" \t\n", rune(p.expr[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept consumes the first of the operators found at the current position.
+func (p *pluralParser) accept(operators ...string) string {
+	p.skipSpaces()
+
+	for _, operator := range operators {
+		if !strings.HasPrefix(p.expr[p.pos:], operator) {
+			continue
+		}
+
+		// Don’t take “<” from “<=” nor “!” from “!=”.
+		next := p.pos + len(operator)
+
+		if len(operator) == 1 && next < len(p.expr) && p.expr[next] == '=' && strings.Contains("<>!=", operator) {
+			continue
+		}
+
+		p.pos = next
+		return operator
+	}
+
+	return ""
+}
+
+func (p *pluralParser) ternary() (func(int) int, error) {
+	condition, err := p.binary(0)
+
+	if err != nil || p.accept("?") == "" {
+		return condition, err
+	}
+
+	whenTrue, err := p.ternary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept(":") == "" {
+		return nil, p.errorf("missing “:”")
+	}
+
+	whenFalse, err := p.ternary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(n int) int {
+		if condition(n) != 0 {
+			return whenTrue(n)
+		}
+
+		return whenFalse(n)
+	}, nil
+}
+
+// pluralOperators lists the binary operators by increasing precedence.
+var pluralOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pluralParser) binary(level int) (func(int) int, error) {
+	if level == len(pluralOperators) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := p.accept(pluralOperators[level]...)
+
+		if operator == "" {
+			return left, nil
+		}
+
+		right, err := p.binary(level + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = pluralOperation(operator, left, right)
+	}
+}
+
+func pluralOperation(operator string, left, right func(int) int) func(int) int {
+	boolean := func(b bool) int {
+		if b {
+			return 1
+		}
+
+		return 0
+	}
+
+	return func(n int) int {
+		a := left(n)
+
+		switch operator {
+		case "||":
+			return boolean(a != 0 || right(n) != 0)
+		case "&&":
+			return boolean(a != 0 && right(n) != 0)
+		}
+
+		b := right(n)
+
+		switch operator {
+		case "==":
+			return boolean(a == b)
+		case "!=":
+			return boolean(a != b)
+		case "<=":
+			return boolean(a <= b)
+		case ">=":
+			return boolean(a >= b)
+		case "<":
+			return boolean(a < b)
+		case ">":
+			return boolean(a > b)
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		}
+
+		if b == 0 {
+			return 0
+		}
+
+		if operator == "/" {
+			return a / b
+		}
+
+		return a % b
+	}
+}
+
+func (p *pluralParser) unary() (func(int) int, error) {
+	switch p.accept("!", "-") {
+	case "!":
+		operand, err := p.unary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(n int) int {
+			if operand(n) == 0 {
+				return 1
+			}
+
+			return 0
+		}, nil
+	case "-":
+		operand, err := p.unary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(n int) int { return -operand(n) }, nil
+	}
+
+	return p.primary()
+}
+
+func (p *pluralParser) primary() (func(int) int, error) {
+	if p.accept("(") != "" {
+		f, err := p.ternary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.accept(")") == "" {
+			return nil, p.errorf("missing “)”")
+		}
+
+		return f, nil
+	}
+
+	if p.accept("n") != "" {
+		return func(n int) int { return n }, nil
+	}
+
+	start := p.pos
+
+	for p.pos < len(p.expr) && p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		if p.pos == len(p.expr) {
+			return nil, p.errorf("unexpected end")
+		}
+
+		return nil, p.errorf("unexpected “%s”", p.expr[p.pos:])
+	}
+
+	value, err := strconv.Atoi(p.expr[start:p.pos])
+
+	if err != nil {
+		return nil, p.errorf("%s", err)
+	}
+
+	return func(int) int { return value }, nil
+}
@@ -0,0 +1,311 @@
+package trama
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPluralForms(t *testing.T) {
+	data := []struct {
+		description     string
+		header          string
+		counts          []int
+		expectedIndexes []int
+		expectedError   bool
+	}{
+		{
+			description:     "It should evaluate the rule of English",
+			header:          "nplurals=2; plural=(n != 1);",
+			counts:          []int{0, 1, 2},
+			expectedIndexes: []int{1, 0, 1},
+		},
+		{
+			description:     "It should evaluate the rule of Brazilian Portuguese",
+			header:          "nplurals=2; plural=(n > 1);",
+			counts:          []int{0, 1, 2},
+			expectedIndexes: []int{0, 0, 1},
+		},
+		{
+			description:     "It should evaluate nested conditionals",
+			header:          "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+			counts:          []int{1, 2, 5, 11, 21, 22, 25, 112},
+			expectedIndexes: []int{0, 1, 2, 2, 0, 1, 2, 2},
+		},
+		{
+			description:     "It should evaluate a rule without plural forms",
+			header:          "nplurals=1; plural=0;",
+			counts:          []int{0, 1, 2},
+			expectedIndexes: []int{0, 0, 0},
+		},
+		{
+			description:     "It should evaluate unary operators",
+			header:          "nplurals=2; plural=!(n == -(-1));",
+			counts:          []int{0, 1, 2},
+			expectedIndexes: []int{1, 0, 1},
+		},
+		{
+			description:   "It should refuse an unbalanced expression",
+			header:        "nplurals=2; plural=(n != 1;",
+			expectedError: true,
+		},
+		{
+			description:   "It should refuse an unknown variable",
+			header:        "nplurals=2; plural=m != 1;",
+			expectedError: true,
+		},
+		{
+			description:   "It should refuse a missing number of forms",
+			header:        "plural=n != 1;",
+			expectedError: true,
+		},
+	}
+
+	for i, item := range data {
+		rule, err := parsePluralForms(item.header)
+
+		if item.expectedError {
+			if err == nil {
+				t.Errorf("Item %d, “%s”: no errors found", i, item.description)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		for k, n := range item.counts {
+			if index := rule.index(n); index != item.expectedIndexes[k] {
+				t.Errorf("Item %d, “%s”, wrong form for %d. Expecting %d; found %d", i, item.description, n, item.expectedIndexes[k], index)
+			}
+		}
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	po := `# Tecendo a manhã
+msgid ""
+msgstr ""
+"Language: pt_BR\n"
+"Plural-Forms: nplurals=2; plural=(n > 1);\n"
+
+msgid "A rooster alone doesn't weave a morning"
+msgstr "Um galo sozinho não tece uma manhã"
+
+#: poema.html:2
+msgid "%d rooster"
+msgid_plural "%d roosters"
+msgstr[0] "%d galo"
+msgstr[1] "%d galos"
+
+#, fuzzy
+msgid "morning"
+msgstr "manhã"
+
+msgid "tent"
+msgstr ""
+
+msgctxt "verb"
+msgid "weave"
+msgstr "tecer"
+msgid "light "
+"balloon"
+msgstr "luz "
+"balão"
+`
+
+	json := `{
+	"plural_forms": "nplurals=2; plural=(n > 1);",
+	"messages": {
+		"A rooster alone doesn't weave a morning": "Um galo sozinho não tece uma manhã",
+		"%d rooster": ["%d galo", "%d galos"],
+		"light balloon": "luz balão"
+	}
+}`
+
+	poCatalog, err := LoadPOCatalog(strings.NewReader(po))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonCatalog, err := LoadJSONCatalog(strings.NewReader(json))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		description     string
+		id              string
+		n               int
+		expectedMessage string
+		expectedFound   bool
+	}{
+		{
+			description:     "It should translate a message",
+			id:              "A rooster alone doesn't weave a morning",
+			n:               1,
+			expectedMessage: "Um galo sozinho não tece uma manhã",
+			expectedFound:   true,
+		},
+		{
+			description:     "It should follow the plural rule for zero",
+			id:              "%d rooster",
+			n:               0,
+			expectedMessage: "%d galo",
+			expectedFound:   true,
+		},
+		{
+			description:     "It should follow the plural rule for many",
+			id:              "%d rooster",
+			n:               2,
+			expectedMessage: "%d galos",
+			expectedFound:   true,
+		},
+		{
+			description:     "It should join the continuation strings",
+			id:              "light balloon",
+			n:               1,
+			expectedMessage: "luz balão",
+			expectedFound:   true,
+		},
+		{
+			description: "It should ignore an untranslated message",
+			id:          "tent",
+			n:           1,
+		},
+	}
+
+	for _, catalog := range []*Catalog{poCatalog, jsonCatalog} {
+		for i, item := range data {
+			message, found := catalog.message(item.id, item.n)
+
+			if message != item.expectedMessage || found != item.expectedFound {
+				t.Errorf("Item %d, “%s”, wrong message. Expecting “%s” (%t); found “%s” (%t)", i, item.description, item.expectedMessage, item.expectedFound, message, found)
+			}
+		}
+	}
+
+	for _, id := range []string{"morning", "weave"} {
+		if message, found := poCatalog.message(id, 1); found {
+			t.Errorf("Unexpected message “%s” for “%s”", message, id)
+		}
+	}
+
+	invalid := []string{
+		"msgid \"galo\"\nmsgstr[1] \"galos\"\n",
+		"msgid \"galo\"\nmsgtxt \"galos\"\n",
+		"\"galo\"\n",
+		"msgid \"\"\nmsgstr \"Plural-Forms: nplurals=2; plural=n >;\\n\"\n",
+	}
+
+	for i, content := range invalid {
+		if _, err := LoadPOCatalog(strings.NewReader(content)); err == nil {
+			t.Errorf("Item %d: no errors found for an invalid PO catalog", i)
+		}
+	}
+
+	if _, err := LoadJSONCatalog(strings.NewReader(`{"messages": {"galo": 1}}`)); err == nil {
+		t.Error("No errors found for an invalid JSON catalog")
+	}
+}
+
+func TestCatalogTemplate(t *testing.T) {
+	files := fstest.MapFS{
+		"poema.html": &fstest.MapFile{
+			Data: []byte(`{{T "A rooster alone doesn't weave a morning"}}: {{N "%d rooster" "%d roosters" .Count .Count}}, {{T "%s and %s" "sun" "light"}}`),
+		},
+	}
+
+	pt, err := LoadJSONCatalog(strings.NewReader(`{
+		"plural_forms": "nplurals=2; plural=(n > 1);",
+		"messages": {
+			"A rooster alone doesn't weave a morning": "Um galo sozinho não tece uma manhã",
+			"%d rooster": ["%d galo", "%d galos"]
+		}
+	}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ptBR, err := LoadJSONCatalog(strings.NewReader(`{"messages": {"%s and %s": "%s e %s"}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := NewTemplateGroupSet(nil)
+	set.DefaultGroup = "en"
+	set.Insert(TemplateGroup{Name: "en", FS: files, Files: []string{"poema.html"}})
+	set.Insert(TemplateGroup{Name: "pt", Catalog: pt})
+	set.Insert(TemplateGroup{Name: "pt-BR", Catalog: ptBR, Fallback: []string{"pt"}})
+
+	if err := set.parse("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		description    string
+		group          string
+		count          interface{}
+		expectedResult string
+	}{
+		{
+			description:    "It should use the messages themselves without a catalog",
+			group:          "en",
+			count:          2,
+			expectedResult: "A rooster alone doesn&#39;t weave a morning: 2 roosters, sun and light",
+		},
+		{
+			description:    "It should use the singular without a catalog",
+			group:          "en",
+			count:          uint8(1),
+			expectedResult: "A rooster alone doesn&#39;t weave a morning: 1 rooster, sun and light",
+		},
+		{
+			description:    "It should translate with the group’s catalog",
+			group:          "pt",
+			count:          int64(0),
+			expectedResult: "Um galo sozinho não tece uma manhã: 0 galo, sun and light",
+		},
+		{
+			description:    "It should translate with the catalogs of the fallbacks",
+			group:          "pt-BR",
+			count:          3,
+			expectedResult: "Um galo sozinho não tece uma manhã: 3 galos, sun e light",
+		},
+	}
+
+	for i, item := range data {
+		group, err := set.lookup(item.group, "poema.html")
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		var result bytes.Buffer
+
+		if err := group.executeTemplate(&result, "", "poema.html", struct{ Count interface{} }{item.count}, nil); err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		if result.String() != item.expectedResult {
+			t.Errorf("Item %d, “%s”, wrong result. Expecting “%s”; found “%s”", i, item.description, item.expectedResult, result.String())
+		}
+	}
+
+	var result bytes.Buffer
+	group, _ := set.lookup("pt", "poema.html")
+
+	if err := group.executeTemplate(&result, "", "poema.html", struct{ Count string }{"muitos"}, nil); err == nil {
+		t.Error("No errors found for a count that isn’t an integer")
+	}
+}
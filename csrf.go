@@ -0,0 +1,239 @@
+package trama
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+const (
+	// CSRFField is the name of the form field carrying the CSRF token.
+	CSRFField = "_csrf"
+
+	// CSRFHeader is the name of the header carrying the CSRF token, for the
+	// requests made by scripts.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRFInterceptor protects the handlers against cross-site request forgery:
+// the requests of unsafe methods, such as POST, must carry a token, in the
+// CSRFField form field or in the CSRFHeader header, matching the one of the
+// client, or they are rejected with a 403 (Forbidden) HTTPError. If the
+// client has a stored session (see SessionInterceptor, which must come first
+// in the chain), the token is kept in the session; otherwise, it is kept in a
+// cookie and checked against the submitted one, which is known as the
+// double-submit cookie pattern. Once the client is given a session, the
+// cookie is expired and a token of the session is used instead, which is
+// replaced whenever the session’s identifier is renewed (see Session’s
+// RenewID method), so that a token known before signing in is no longer
+// accepted.
+//
+// The token is given to the templates by the csrfField function, writing the
+// hidden form field, and by the csrfToken function, writing the token itself.
+// The token written is masked by a random pad in each response, so that it
+// can’t be guessed from the size of the compressed pages.
+// As the templates are checked when parsed, these functions must be declared
+// in the FuncMap of the template group set:
+//
+//	set := trama.NewTemplateGroupSet(trama.CSRFFuncMap())
+//
+//	<form method="post">{{csrfField}} … </form>
+//
+// A handler implementing CSRFExempter can opt out of the check.
+type CSRFInterceptor struct {
+	NopInterceptor
+
+	// Cookie is the name of the cookie holding the token of the requests
+	// without a session; “csrf” if empty.
+	Cookie string
+
+	// Path and Domain are the scope of the cookie. The path is “/” if empty.
+	Path, Domain string
+
+	// Secure restricts the cookie to HTTPS requests.
+	Secure bool
+}
+
+// CSRFExempter is implemented by the handlers whose requests aren’t checked by
+// CSRFInterceptor, such as webhooks authenticated by other means.
+type CSRFExempter interface {
+	CSRFExempt() bool
+}
+
+// CSRFFuncMap returns placeholders of the template functions bound by
+// CSRFInterceptor, to be declared in the FuncMap of the template group set.
+func CSRFFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML { return "" },
+		"csrfToken": func() string { return "" },
+	}
+}
+
+// Before checks the token of the requests of unsafe methods and binds the
+// token of the client to the template functions, creating it if needed.
+func (c *CSRFInterceptor) Before(res Response, r *http.Request) error {
+	if exempter, ok := requestHandler(r).(CSRFExempter); ok && exempter.CSRFExempt() {
+		return nil
+	}
+
+	// Only a session already stored keeps the token, so that no session is
+	// created just to hold the token of an anonymous client.
+	session := CurrentSession(r)
+
+	if session != nil && session.ID() == "" {
+		session = nil
+	}
+
+	var raw []byte
+
+	if session != nil {
+		raw = decodeCSRFToken(session.Get(CSRFField))
+
+		if _, err := r.Cookie(c.cookieName()); err == nil {
+			c.setCookie(res, "", -1)
+		}
+	} else if cookie, err := r.Cookie(c.cookieName()); err == nil {
+		raw = decodeCSRFToken(cookie.Value)
+	}
+
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+	default:
+		submitted := r.Header.Get(CSRFHeader)
+
+		if submitted == "" {
+			submitted = r.PostFormValue(CSRFField)
+		}
+
+		if raw == nil || subtle.ConstantTimeCompare(raw, unmaskCSRFToken(submitted)) != 1 {
+			return NewHTTPError(http.StatusForbidden, "Invalid CSRF token", nil)
+		}
+	}
+
+	if raw == nil {
+		raw = newCSRFToken()
+		token := base64.RawURLEncoding.EncodeToString(raw)
+
+		if session != nil {
+			session.Set(CSRFField, token)
+		} else {
+			c.setCookie(res, token, 0)
+		}
+	}
+
+	// The token is looked up when the page is rendered, as the handler may
+	// have renewed the session, replacing its token.
+	masked := func() string {
+		if session := CurrentSession(r); session != nil {
+			if renewed := decodeCSRFToken(session.Get(CSRFField)); renewed != nil {
+				return maskCSRFToken(renewed)
+			}
+		}
+
+		return maskCSRFToken(raw)
+	}
+
+	res.SetTemplateFuncs(template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+				CSRFField, template.HTMLEscapeString(masked())))
+		},
+		"csrfToken": masked,
+	})
+
+	return nil
+}
+
+func (c *CSRFInterceptor) cookieName() string {
+	if c.Cookie == "" {
+		return "csrf"
+	}
+
+	return c.Cookie
+}
+
+// setCookie sends the cookie holding the token, or expiring it if maxAge is
+// negative.
+func (c *CSRFInterceptor) setCookie(res Response, token string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    token,
+		MaxAge:   maxAge,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	res.SetCookie(cookie)
+}
+
+// csrfTokenLength is the length in bytes of the CSRF tokens.
+const csrfTokenLength = 32
+
+// newCSRFToken generates a random token.
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLength)
+
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+
+	return token
+}
+
+// decodeCSRFToken decodes a token kept by the client, returning nil for a
+// malformed one, which is taken as missing.
+func decodeCSRFToken(token string) []byte {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil || len(raw) != csrfTokenLength {
+		return nil
+	}
+
+	return raw
+}
+
+// maskCSRFToken XORs the token with a random pad, which is prepended to the
+// result, so that the token written in each response is different. Otherwise,
+// the secret repeated in every compressed page could be guessed by the size of
+// the responses, as in the BREACH attack.
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+
+	if _, err := rand.Read(pad); err != nil {
+		panic(err)
+	}
+
+	for i, b := range token {
+		masked[len(token)+i] = pad[i] ^ b
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken reverts maskCSRFToken, returning nil for a malformed token.
+func unmaskCSRFToken(masked string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(masked)
+
+	if err != nil || len(b) != 2*csrfTokenLength {
+		return nil
+	}
+
+	token := make([]byte, csrfTokenLength)
+
+	for i := range token {
+		token[i] = b[i] ^ b[csrfTokenLength+i]
+	}
+
+	return token
+}
@@ -0,0 +1,396 @@
+package trama
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var csrfFieldPattern = regexp.MustCompile(`^<form><input type="hidden" name="_csrf" value="([A-Za-z0-9_-]{86})"></form>$`)
+
+func TestCSRFInterceptor(t *testing.T) {
+	const token = "Y2FuY2FvLWRvLWV4aWxpby1taW5oYS10ZXJyYS10ZW0"
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	masked := maskCSRFToken(raw)
+
+	data := []struct {
+		description    string
+		method         string
+		cookie         string
+		field          string
+		header         string
+		exempt         bool
+		expectedStatus int
+	}{
+		{
+			description:    "It should accept a safe request without token",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "It should accept the token of the form field",
+			method:         "POST",
+			cookie:         token,
+			field:          masked,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "It should accept the token of the header",
+			method:         "DELETE",
+			cookie:         token,
+			header:         masked,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "It should reject a token not matching the cookie",
+			method:         "POST",
+			cookie:         token,
+			field:          maskCSRFToken([]byte("minha-terra-tem-palmeiras-onde-c")),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "It should reject an unmasked token",
+			method:         "POST",
+			cookie:         token,
+			field:          token,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "It should reject a request without cookie",
+			method:         "POST",
+			field:          masked,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "It should reject a request without token",
+			method:         "POST",
+			cookie:         token,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "It should skip the check for an exempt handler",
+			method:         "POST",
+			exempt:         true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for i, item := range data {
+		templates := csrfTemplates()
+		mux := NewMux()
+		mux.Register("/", func() Handler {
+			return &csrfHandler{templates: templates, exempt: item.exempt}
+		})
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		form := url.Values{}
+
+		if item.field != "" {
+			form.Set(CSRFField, item.field)
+		}
+
+		r := httptest.NewRequest(item.method, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if item.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "csrf", Value: item.cookie})
+		}
+
+		if item.header != "" {
+			r.Header.Set(CSRFHeader, item.header)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+	}
+}
+
+func TestCSRFInterceptorToken(t *testing.T) {
+	now := time.Now()
+
+	data := []struct {
+		description    string
+		sessions       bool
+		session        *SessionData
+		expectedCookie string
+	}{
+		{
+			description:    "It should keep the token in a cookie",
+			expectedCookie: "csrf",
+		},
+		{
+			description:    "It should keep the token of a client without session in a cookie",
+			sessions:       true,
+			expectedCookie: "csrf",
+		},
+		{
+			description:    "It should keep the token in the stored session",
+			sessions:       true,
+			session:        &SessionData{ID: sessionID, Values: map[string]string{}, Created: now, Accessed: now},
+			expectedCookie: "session",
+		},
+	}
+
+	for i, item := range data {
+		store := NewMemorySessionStore()
+		templates := csrfTemplates()
+
+		if item.session != nil {
+			store.Save(item.session)
+		}
+
+		mux := NewMux()
+		mux.Register("/", func() Handler {
+			handler := &csrfHandler{templates: templates}
+
+			if item.sessions {
+				handler.sessions = &SessionInterceptor{Store: store}
+			}
+
+			return handler
+		})
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+
+		if item.session != nil {
+			r.AddCookie(&http.Cookie{Name: "session", Value: item.session.ID})
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		match := csrfFieldPattern.FindStringSubmatch(w.Body.String())
+
+		if match == nil {
+			t.Errorf("Item %d, “%s”, unexpected body “%s”", i, item.description, w.Body.String())
+			continue
+		}
+
+		cookies := w.Result().Cookies()
+
+		if len(cookies) != 1 {
+			t.Errorf("Item %d, “%s”, wrong number of cookies. Expecting 1; found %d", i, item.description, len(cookies))
+			continue
+		}
+
+		if cookies[0].Name != item.expectedCookie {
+			t.Errorf("Item %d, “%s”, wrong cookie. Expecting “%s”; found “%s”", i, item.description, item.expectedCookie, cookies[0].Name)
+		}
+
+		token := unmaskCSRFToken(match[1])
+
+		if item.expectedCookie == "csrf" && cookies[0].Value != base64.RawURLEncoding.EncodeToString(token) {
+			t.Errorf("Item %d, “%s”, the token of the form doesn’t match the cookie", i, item.description)
+		}
+
+		if sessions := len(store.sessions); item.session == nil && sessions != 0 {
+			t.Errorf("Item %d, “%s”, a session was created for the token", i, item.description)
+		}
+
+		form := url.Values{CSRFField: {match[1]}}
+		r = httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookies[0])
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, http.StatusOK, w.Code)
+		}
+
+		next := csrfFieldPattern.FindStringSubmatch(w.Body.String())
+
+		if next == nil {
+			t.Errorf("Item %d, “%s”, unexpected body “%s”", i, item.description, w.Body.String())
+			continue
+		}
+
+		if next[1] == match[1] {
+			t.Errorf("Item %d, “%s”, the token wasn’t masked again", i, item.description)
+		}
+
+		if !bytes.Equal(unmaskCSRFToken(next[1]), token) {
+			t.Errorf("Item %d, “%s”, the token changed", i, item.description)
+		}
+	}
+}
+
+func TestCSRFInterceptorSessionToken(t *testing.T) {
+	const token = "Y2FuY2FvLWRvLWV4aWxpby1taW5oYS10ZXJyYS10ZW0"
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	now := time.Now()
+
+	data := []struct {
+		description     string
+		method          string
+		sessionToken    string
+		renew           bool
+		expectedStatus  int
+		expectedRenewal bool
+	}{
+		{
+			description:    "It should reject the token of the cookie for a stored session",
+			method:         "POST",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:     "It should keep a new token in a stored session without one",
+			method:          "GET",
+			expectedStatus:  http.StatusOK,
+			expectedRenewal: true,
+		},
+		{
+			description:    "It should accept the token of the session",
+			method:         "POST",
+			sessionToken:   token,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:     "It should replace the token when renewing the session",
+			method:          "POST",
+			sessionToken:    token,
+			renew:           true,
+			expectedStatus:  http.StatusOK,
+			expectedRenewal: true,
+		},
+	}
+
+	for i, item := range data {
+		store := NewMemorySessionStore()
+		templates := csrfTemplates()
+		values := map[string]string{}
+
+		if item.sessionToken != "" {
+			values[CSRFField] = item.sessionToken
+		}
+
+		store.Save(&SessionData{ID: sessionID, Values: values, Created: now, Accessed: now})
+
+		mux := NewMux()
+		mux.Register("/", func() Handler {
+			return &csrfHandler{templates: templates, sessions: &SessionInterceptor{Store: store}, renew: item.renew}
+		})
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		form := url.Values{CSRFField: {maskCSRFToken(raw)}}
+		r := httptest.NewRequest(item.method, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: "session", Value: sessionID})
+		r.AddCookie(&http.Cookie{Name: "csrf", Value: token})
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == "csrf" && cookie.MaxAge >= 0 {
+				t.Errorf("Item %d, “%s”, the cookie of the token wasn’t expired", i, item.description)
+			}
+		}
+
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		match := csrfFieldPattern.FindStringSubmatch(w.Body.String())
+
+		if match == nil {
+			t.Errorf("Item %d, “%s”, unexpected body “%s”", i, item.description, w.Body.String())
+			continue
+		}
+
+		var stored string
+
+		for _, session := range store.sessions {
+			stored = session.Values[CSRFField]
+		}
+
+		if len(store.sessions) != 1 {
+			t.Errorf("Item %d, “%s”, wrong number of sessions. Expecting 1; found %d", i, item.description, len(store.sessions))
+		}
+
+		if renewed := stored != token; renewed != item.expectedRenewal {
+			t.Errorf("Item %d, “%s”, wrong token renewal. Expecting %t; found %t", i, item.description, item.expectedRenewal, renewed)
+		}
+
+		if base64.RawURLEncoding.EncodeToString(unmaskCSRFToken(match[1])) != stored {
+			t.Errorf("Item %d, “%s”, the token of the form doesn’t match the session", i, item.description)
+		}
+	}
+}
+
+func csrfTemplates() TemplateGroupSet {
+	set := NewTemplateGroupSet(CSRFFuncMap())
+	set.Insert(TemplateGroup{
+		FS:       fstest.MapFS{"form.html": &fstest.MapFile{Data: []byte(`<form>{{csrfField}}</form>`)}},
+		Patterns: []string{"*.html"},
+	})
+
+	return set
+}
+
+type csrfHandler struct {
+	NopHandler
+	templates TemplateGroupSet
+	sessions  *SessionInterceptor
+	exempt    bool
+	renew     bool
+}
+
+func (h *csrfHandler) Interceptors() InterceptorChain {
+	if h.sessions != nil {
+		return NewInterceptorChain(h.sessions, &CSRFInterceptor{})
+	}
+
+	return NewInterceptorChain(&CSRFInterceptor{})
+}
+
+func (h *csrfHandler) CSRFExempt() bool {
+	return h.exempt
+}
+
+func (h *csrfHandler) Templates() TemplateGroupSet {
+	return h.templates
+}
+
+func (h *csrfHandler) Get(res Response, r *http.Request) error {
+	res.ExecuteTemplate("form.html", nil)
+	return nil
+}
+
+func (h *csrfHandler) Post(res Response, r *http.Request) error {
+	if h.renew {
+		CurrentSession(r).RenewID()
+	}
+
+	return h.Get(res, r)
+}
+
+func (h *csrfHandler) Delete(res Response, r *http.Request) error {
+	return h.Get(res, r)
+}
@@ -8,13 +8,35 @@ This way, a handler can be an arbitrarily complex structure holding any
 information it needs. This comes in handy when used with another trama
 functionality: interceptors.
 
+Besides Get and Post, required by the Handler interface, a handler can serve
+PUT, PATCH and DELETE requests by implementing the Putter, Patcher and Deleter
+interfaces. HEAD requests are served by Get with the response body discarded,
+OPTIONS requests are answered with the methods the handler implements and any
+other method is answered with a 405 (Method Not Allowed) status. These answers
+are given before the interceptors, which are not called, so that no transaction
+is begun nor form validated just to refuse a request. The headers these answers
+need, such as the Access-Control headers of a CORS preflight request, are set
+by the Mux’s Refuse function instead:
+
+	mux.Refuse = func(res trama.Response, r *http.Request) {
+		if r.Method == "OPTIONS" && r.Header.Get("Origin") == "https://registro.br" {
+			res.SetHeader("Access-Control-Allow-Origin", "https://registro.br")
+			res.SetHeader("Access-Control-Allow-Methods", res.Header().Get("Allow"))
+		}
+	}
+
 Interceptors are special units that are called before and after every handler
 method call. With interceptors, one can automate most of the repetitive tasks
 involving a request handling, like the setup and commit of a database
 transaction and automatic decode of query string parameters. Since a handler is
 an object that can store any kind of information, an interceptor can be used to
 setup this information before the handler process the request and to make any
-cleanup after it.
+cleanup after it. The Binder interceptor, for instance, decodes the query
+string, form, path parameters and JSON body of the request into the tagged
+fields of the handler, which the Validator interceptor then checks against the
+rules of their validate tags; and the Transaction interceptor gives the handler
+a database transaction, committed or rolled back according to the outcome of
+the request.
 
 If the handler register the interceptor chain [a, b, c], the framework will
 call, in order:
@@ -22,11 +44,19 @@ call, in order:
 	a.Before
 	b.Before
 	c.Before
-	handler.Method (any of Get or Post)
+	handler.Method (any of Get, Post, Put, Patch or Delete)
 	c.After
 	b.After
 	a.After
 
+The interceptors implementing AroundInterceptor also have their Around method
+wrapping the handler method. If all of [a, b, c] implement it, the handler
+method is called as:
+
+	a.Around(b.Around(c.Around(handler.Method)))
+
+after c.Before and before c.After.
+
 If any of the interceptors' Before returns an error, the chain is interrupted.
 Say, for example, that the Before method of the b interceptor returns an
 error; then, the execution will be:
@@ -35,5 +65,16 @@ error; then, the execution will be:
 	b.Before
 	b.After
 	a.After
+
+An interceptor can use Response’s WithContext method in its Before to derive
+the request passed along the chain, setting values in its context. If the
+request’s context is done, the chain is interrupted as well, before the next
+Before or the handler method, and the context’s error is passed to the After
+methods of the interceptors already called.
+
+The error returned by the handler, or by the interrupting Before, is passed to
+every After method. If none of them writes a response, the error is written
+by the Mux’s ErrorRenderer; a handler can return an HTTPError to choose the
+status code and the message shown to the client.
 */
 package trama
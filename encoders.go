@@ -0,0 +1,50 @@
+package trama
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+)
+
+// An Encoder serialises values to be written as the body of a response. See
+// Response’s Encode method.
+type Encoder interface {
+	// ContentType returns the media type of the encoded values, sent in the
+	// Content-Type header of the response.
+	ContentType() string
+
+	// Encode writes the encoding of v to w.
+	Encode(w io.Writer, v interface{}) error
+}
+
+var (
+	// JSONEncoder encodes values as JSON, using the encoding/json package.
+	JSONEncoder Encoder = jsonEncoder{}
+
+	// XMLEncoder encodes values as XML, using the encoding/xml package.
+	XMLEncoder Encoder = xmlEncoder{}
+)
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,153 @@
+package trama
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	data := []struct {
+		description         string
+		encoder             Encoder
+		status              int
+		payload             interface{}
+		interceptors        InterceptorChain
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+		expectError         bool
+	}{
+		{
+			description:         "It should write the payload as JSON",
+			status:              http.StatusCreated,
+			payload:             map[string]string{"poema": "Tecendo a manhã"},
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedBody:        "{\"poema\":\"Tecendo a manhã\"}\n",
+		},
+		{
+			description:         "It should write the payload as XML",
+			encoder:             XMLEncoder,
+			status:              http.StatusOK,
+			payload:             poem{Title: "Tecendo a manhã"},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody:        "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<poema><titulo>Tecendo a manhã</titulo></poema>",
+		},
+		{
+			description:         "It should write the status code 200 when none is given",
+			payload:             []int{1, 2, 3},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedBody:        "[1,2,3]\n",
+		},
+		{
+			description:    "It should let an interceptor replace the payload",
+			status:         http.StatusOK,
+			payload:        "um galo sozinho",
+			interceptors:   InterceptorChain{&replacePayloadInterceptor{}},
+			expectedStatus: http.StatusAccepted,
+
+			expectedContentType: "application/json; charset=utf-8",
+			expectedBody:        "\"UM GALO SOZINHO\"\n",
+		},
+		{
+			description:    "It should write a 500 when the encoding fails",
+			encoder:        brokenEncoder{},
+			status:         http.StatusOK,
+			payload:        "nada",
+			expectedStatus: http.StatusInternalServerError,
+			expectError:    true,
+		},
+	}
+
+	for i, item := range data {
+		handler := adapter{
+			handler: func() Handler {
+				return &encodeHandler{
+					encoder:      item.encoder,
+					status:       item.status,
+					payload:      item.payload,
+					interceptors: item.interceptors,
+				}
+			},
+			log: func(err error) {
+				if !item.expectError {
+					t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+				}
+			},
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if contentType := w.Header().Get("Content-Type"); contentType != item.expectedContentType {
+			t.Errorf("Item %d, “%s”, wrong content type. Expecting “%s”; found “%s”", i, item.description, item.expectedContentType, contentType)
+		}
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”;\nfound “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+type encodeHandler struct {
+	NopHandler
+	encoder      Encoder
+	status       int
+	payload      interface{}
+	interceptors InterceptorChain
+}
+
+func (h *encodeHandler) Get(res Response, req *http.Request) error {
+	if h.encoder == nil {
+		res.WriteJSON(h.status, h.payload)
+	} else {
+		res.Encode(h.status, h.encoder, h.payload)
+	}
+
+	return nil
+}
+
+func (h *encodeHandler) Interceptors() InterceptorChain {
+	return h.interceptors
+}
+
+type replacePayloadInterceptor struct {
+	NopInterceptor
+}
+
+func (i *replacePayloadInterceptor) After(res Response, req *http.Request, err error) {
+	if payload, ok := res.Payload().(string); ok {
+		res.WriteJSON(http.StatusAccepted, strings.ToUpper(payload))
+	}
+}
+
+type poem struct {
+	XMLName struct{} `xml:"poema"`
+	Title   string   `xml:"titulo"`
+}
+
+type brokenEncoder struct{}
+
+func (brokenEncoder) ContentType() string {
+	return "application/octet-stream"
+}
+
+func (brokenEncoder) Encode(w io.Writer, v interface{}) error {
+	return errors.New("Um galo sozinho não tece uma manhã")
+}
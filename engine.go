@@ -0,0 +1,569 @@
+package trama
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// An Engine parses and executes the templates of a TemplateGroup (see its
+// Engine field). HTMLEngine and TextEngine, based on html/template and
+// text/template, are provided; other template languages can be used by
+// implementing this interface.
+type Engine interface {
+	// ContentType returns the media type of the documents rendered by the
+	// templates, sent when the response has no Content-Type header.
+	ContentType() string
+
+	// Parse parses the files of a group, naming the templates after the base
+	// names of the files. The functions, which include the ones of the
+	// FuncMaps and of the catalog, must be available to the templates. Empty
+	// delimiters stand for the engine’s default ones.
+	Parse(files []TemplateFile, leftDelim, rightDelim string, funcs map[string]interface{}) (ParsedTemplates, error)
+}
+
+// ParsedTemplates are the templates of a group parsed by an Engine.
+type ParsedTemplates interface {
+	// Defines checks whether there is a template with the given name.
+	Defines(name string) bool
+
+	// ExecuteTemplate executes the named template with the data. If a layout
+	// is given, the layout is executed instead, with the blocks defined by
+	// the named template. The functions, if any, replace the ones with the
+	// same names during this execution only (see Response’s
+	// SetTemplateFuncs method).
+	ExecuteTemplate(w io.Writer, layout, name string, data interface{}, funcs map[string]interface{}) error
+}
+
+var (
+	// HTMLEngine parses the templates with html/template, which escapes the
+	// data according to its context in the HTML document. It is the engine
+	// of the groups without one.
+	HTMLEngine Engine = goEngine{html: true}
+
+	// TextEngine parses the templates with text/template, to render plain
+	// text documents such as emails or CSV files.
+	TextEngine Engine = goEngine{}
+)
+
+// A TemplateFile is a template file, read either from a file system or from
+// the operating system’s file system when FS is nil.
+type TemplateFile struct {
+	FS   fs.FS
+	Name string
+}
+
+// Base returns the file’s base name, which names its template.
+func (f TemplateFile) Base() string {
+	if f.FS == nil {
+		return filepath.Base(f.Name)
+	}
+
+	return path.Base(f.Name)
+}
+
+// ReadFile reads the contents of the file.
+func (f TemplateFile) ReadFile() ([]byte, error) {
+	if f.FS == nil {
+		return ioutil.ReadFile(f.Name)
+	}
+
+	return fs.ReadFile(f.FS, f.Name)
+}
+
+func (f TemplateFile) stat() (fs.FileInfo, error) {
+	if f.FS == nil {
+		return os.Stat(f.Name)
+	}
+
+	return fs.Stat(f.FS, f.Name)
+}
+
+// goEngine is the engine of Go’s template packages, whose parse trees allow
+// the templates to be checked (see Mux’s Validate method and
+// TemplateGroupSet’s Bind method).
+type goEngine struct {
+	html bool
+}
+
+func (e goEngine) ContentType() string {
+	if e.html {
+		return "text/html; charset=utf-8"
+	}
+
+	return "text/plain; charset=utf-8"
+}
+
+func (e goEngine) new(name, leftDelim, rightDelim string, funcs map[string]interface{}) goTemplate {
+	if e.html {
+		return htmlTemplate{htmltemplate.New(name).Delims(leftDelim, rightDelim).Funcs(funcs)}
+	}
+
+	return textTemplate{texttemplate.New(name).Delims(leftDelim, rightDelim).Funcs(funcs)}
+}
+
+func (e goEngine) Parse(files []TemplateFile, leftDelim, rightDelim string, funcs map[string]interface{}) (ParsedTemplates, error) {
+	templ := e.new("", leftDelim, rightDelim, funcs)
+
+	for _, file := range files {
+		if err := parseFile(templ, file); err != nil {
+			return nil, err
+		}
+	}
+
+	prototype, err := templ.Clone()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &goTemplates{
+		engine:     e,
+		files:      files,
+		leftDelim:  leftDelim,
+		rightDelim: rightDelim,
+		funcs:      funcs,
+		templ:      templ,
+		prototype:  prototype,
+		pages:      make(map[pageKey]*goPage),
+	}, nil
+}
+
+// hasBlocks checks whether the templates parsed from a single file define
+// templates the file also executes, as it happens with {{block}}.
+func hasBlocks(templ goTemplate, file TemplateFile) bool {
+	for _, t := range templ.Templates() {
+		if t.Tree() == nil {
+			continue
+		}
+
+		blocks := false
+
+		walkTree(t.Tree().Root, func(node parse.Node) {
+			if node, ok := node.(*parse.TemplateNode); ok && templ.Lookup(node.Name) != nil && node.Name != file.Base() {
+				blocks = true
+			}
+		})
+
+		if blocks {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseFile adds the file to the templates, naming it after the file’s base
+// name, as template.ParseFiles does.
+func parseFile(templ goTemplate, file TemplateFile) error {
+	content, err := file.ReadFile()
+
+	if err != nil {
+		return err
+	}
+
+	name := file.Base()
+
+	if name != templ.Name() {
+		templ = templ.New(name)
+	}
+
+	return templ.Parse(string(content))
+}
+
+// trees maps the names of the templates to their parse trees.
+func trees(templ goTemplate) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+
+	for _, t := range templ.Templates() {
+		if t.Tree() != nil {
+			trees[t.Name()] = t.Tree()
+		}
+	}
+
+	return trees
+}
+
+// goTemplates are the templates parsed by goEngine.
+type goTemplates struct {
+	engine                goEngine
+	files                 []TemplateFile
+	leftDelim, rightDelim string
+	funcs                 map[string]interface{}
+
+	// templ holds every file of the group, parsed in order.
+	templ goTemplate
+
+	// prototype is a never executed copy of templ, as a template can’t be
+	// cloned after its execution.
+	prototype goTemplate
+
+	// defined holds the parse trees of prototype, blocks the ones of the
+	// files with blocks, which are the defaults of the blocks a page doesn’t
+	// define, and shared the ones of the files that aren’t pages, such as
+	// partials. They are only built along with the first page.
+	defined, blocks, shared map[string]*parse.Tree
+
+	// pages holds the copies of the templates already built (see page).
+	pages map[pageKey]*goPage
+	mutex sync.Mutex
+}
+
+type pageKey struct {
+	layout, name string
+}
+
+// goPage holds a copy of the templates needed to render a page, possibly
+// inside a layout.
+type goPage struct {
+	templ     goTemplate
+	prototype goTemplate
+
+	// clones holds the clones of prototype which request-scoped functions
+	// are bound to. A clone is only used by an execution at a time, and it
+	// is escaped by html/template only once, in its first execution.
+	clones sync.Pool
+}
+
+func (g *goTemplates) Defines(name string) bool {
+	return g.templ.Lookup(name) != nil
+}
+
+func (g *goTemplates) ExecuteTemplate(w io.Writer, layout, name string, data interface{}, funcs map[string]interface{}) error {
+	if layout == "" && len(funcs) == 0 {
+		return g.templ.ExecuteTemplate(w, name, data)
+	}
+
+	page, err := g.page(layout, name)
+
+	if err != nil {
+		return err
+	}
+
+	entry := layout
+
+	if entry == "" {
+		entry = name
+	}
+
+	if len(funcs) == 0 {
+		return page.templ.ExecuteTemplate(w, entry, data)
+	}
+
+	templ, _ := page.clones.Get().(goTemplate)
+
+	if templ == nil {
+		if templ, err = page.prototype.Clone(); err != nil {
+			return err
+		}
+	}
+
+	// The functions are bound during this execution only, after which the
+	// ones of the group are restored and the clone is given back to the
+	// pool.
+	templ.Funcs(funcs)
+	defer page.clones.Put(templ)
+
+	restore := make(map[string]interface{}, len(funcs))
+
+	for name := range funcs {
+		if f, found := g.funcs[name]; found {
+			restore[name] = f
+		}
+	}
+
+	defer templ.Funcs(restore)
+	return templ.ExecuteTemplate(w, entry, data)
+}
+
+// file finds the file of the named page, the last one if more than one file
+// has the same base name.
+func (g *goTemplates) file(name string) *TemplateFile {
+	var file *TemplateFile
+
+	for i := range g.files {
+		if g.files[i].Base() == name {
+			file = &g.files[i]
+		}
+	}
+
+	return file
+}
+
+// page returns the copy of the templates reachable from the named page or,
+// if a layout is given, from the layout, building it on the first call. As
+// every page defines the same blocks, a copy for a layout takes the
+// definitions of the page file first, then the ones of the files with blocks,
+// so that a page not defining a block gets the block’s default instead of the
+// definition of another page, and at last the ones of the files that aren’t
+// pages. A file is taken as a page when it defines a template also defined by
+// another file; a template such a file alone defines, missing from the page
+// being rendered, fails the execution instead of leaking into it.
+func (g *goTemplates) page(layout, name string) (*goPage, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	key := pageKey{layout, name}
+
+	if page, found := g.pages[key]; found {
+		return page, nil
+	}
+
+	if g.defined == nil {
+		g.defined = trees(g.prototype)
+	}
+
+	definitions := []map[string]*parse.Tree{g.defined}
+	entry := name
+
+	if layout != "" {
+		file := g.file(name)
+
+		if file == nil {
+			return nil, fmt.Errorf("No page named “%s” to be rendered inside the layout “%s”", name, layout)
+		}
+
+		if g.blocks == nil {
+			if err := g.parseDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+
+		own := g.engine.new("", g.leftDelim, g.rightDelim, g.funcs)
+
+		if err := parseFile(own, *file); err != nil {
+			return nil, err
+		}
+
+		definitions = []map[string]*parse.Tree{trees(own), g.blocks, g.shared}
+		entry = layout
+	}
+
+	prototype := g.engine.new("", g.leftDelim, g.rightDelim, g.funcs)
+	added := make(map[string]bool)
+	var add func(string) error
+
+	add = func(name string) error {
+		if added[name] {
+			return nil
+		}
+
+		added[name] = true
+
+		for _, defined := range definitions {
+			if tree, found := defined[name]; found {
+				// The tree is copied, as html/template rewrites it when
+				// escaping the template.
+				tree = tree.Copy()
+
+				if err := prototype.AddParseTree(name, tree); err != nil {
+					return err
+				}
+
+				var err error
+
+				walkTree(tree.Root, func(node parse.Node) {
+					if node, ok := node.(*parse.TemplateNode); ok && err == nil {
+						err = add(node.Name)
+					}
+				})
+
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := add(entry); err != nil {
+		return nil, err
+	}
+
+	templ, err := prototype.Clone()
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &goPage{templ: templ, prototype: prototype}
+	g.pages[key] = page
+	return page, nil
+}
+
+// parseDefinitions parses each file of the group on its own, sorting its
+// templates into the defaults of the blocks, when the file has blocks, or into
+// the shared templates, when the file isn’t a page.
+func (g *goTemplates) parseDefinitions() error {
+	parsed := make([]map[string]*parse.Tree, len(g.files))
+	withBlocks := make([]bool, len(g.files))
+	definedBy := make(map[string]int)
+
+	for i, file := range g.files {
+		templ := g.engine.new("", g.leftDelim, g.rightDelim, g.funcs)
+
+		if err := parseFile(templ, file); err != nil {
+			return err
+		}
+
+		parsed[i] = trees(templ)
+		withBlocks[i] = hasBlocks(templ, file)
+
+		for name := range parsed[i] {
+			definedBy[name]++
+		}
+	}
+
+	g.blocks = make(map[string]*parse.Tree)
+	g.shared = make(map[string]*parse.Tree)
+
+	for i, file := range g.files {
+		if withBlocks[i] {
+			for name, tree := range parsed[i] {
+				g.blocks[name] = tree
+			}
+
+			continue
+		}
+
+		page := false
+
+		for name := range parsed[i] {
+			if name != file.Base() && definedBy[name] > 1 {
+				page = true
+			}
+		}
+
+		if !page {
+			for name, tree := range parsed[i] {
+				g.shared[name] = tree
+			}
+		}
+	}
+
+	return nil
+}
+
+// goTemplate is the common interface of the templates of html/template and
+// text/template.
+type goTemplate interface {
+	Name() string
+	New(name string) goTemplate
+	Parse(text string) error
+	Clone() (goTemplate, error)
+	AddParseTree(name string, tree *parse.Tree) error
+	Funcs(funcs map[string]interface{})
+	Lookup(name string) goTemplate
+	Templates() []goTemplate
+	Tree() *parse.Tree
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+type htmlTemplate struct {
+	templ *htmltemplate.Template
+}
+
+func (t htmlTemplate) Name() string                       { return t.templ.Name() }
+func (t htmlTemplate) New(name string) goTemplate         { return htmlTemplate{t.templ.New(name)} }
+func (t htmlTemplate) Funcs(funcs map[string]interface{}) { t.templ.Funcs(funcs) }
+func (t htmlTemplate) Tree() *parse.Tree                  { return t.templ.Tree }
+
+func (t htmlTemplate) Parse(text string) error {
+	_, err := t.templ.Parse(text)
+	return err
+}
+
+func (t htmlTemplate) Clone() (goTemplate, error) {
+	clone, err := t.templ.Clone()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return htmlTemplate{clone}, nil
+}
+
+func (t htmlTemplate) AddParseTree(name string, tree *parse.Tree) error {
+	_, err := t.templ.AddParseTree(name, tree)
+	return err
+}
+
+func (t htmlTemplate) Lookup(name string) goTemplate {
+	if templ := t.templ.Lookup(name); templ != nil {
+		return htmlTemplate{templ}
+	}
+
+	return nil
+}
+
+func (t htmlTemplate) Templates() []goTemplate {
+	var templates []goTemplate
+
+	for _, templ := range t.templ.Templates() {
+		templates = append(templates, htmlTemplate{templ})
+	}
+
+	return templates
+}
+
+func (t htmlTemplate) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	return t.templ.ExecuteTemplate(w, name, data)
+}
+
+type textTemplate struct {
+	templ *texttemplate.Template
+}
+
+func (t textTemplate) Name() string                       { return t.templ.Name() }
+func (t textTemplate) New(name string) goTemplate         { return textTemplate{t.templ.New(name)} }
+func (t textTemplate) Funcs(funcs map[string]interface{}) { t.templ.Funcs(funcs) }
+func (t textTemplate) Tree() *parse.Tree                  { return t.templ.Tree }
+
+func (t textTemplate) Parse(text string) error {
+	_, err := t.templ.Parse(text)
+	return err
+}
+
+func (t textTemplate) Clone() (goTemplate, error) {
+	clone, err := t.templ.Clone()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return textTemplate{clone}, nil
+}
+
+func (t textTemplate) AddParseTree(name string, tree *parse.Tree) error {
+	_, err := t.templ.AddParseTree(name, tree)
+	return err
+}
+
+func (t textTemplate) Lookup(name string) goTemplate {
+	if templ := t.templ.Lookup(name); templ != nil {
+		return textTemplate{templ}
+	}
+
+	return nil
+}
+
+func (t textTemplate) Templates() []goTemplate {
+	var templates []goTemplate
+
+	for _, templ := range t.templ.Templates() {
+		templates = append(templates, textTemplate{templ})
+	}
+
+	return templates
+}
+
+func (t textTemplate) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	return t.templ.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,301 @@
+package trama
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEngine(t *testing.T) {
+	files := fstest.MapFS{
+		"html/poema.html": &fstest.MapFile{Data: []byte(`<p>{{.}}</p>`)},
+		"text/poema.txt":  &fstest.MapFile{Data: []byte(`{{template "header.txt"}}{{.}} {{T "morning"}}`)},
+		"text/header.txt": &fstest.MapFile{Data: []byte(`Assunto: `)},
+		"upper/poema":     &fstest.MapFile{Data: []byte(`tecendo a manhã`)},
+	}
+
+	set := NewTemplateGroupSet(nil)
+	set.Insert(TemplateGroup{Name: "html", FS: files, Patterns: []string{"html/*"}})
+	set.Insert(TemplateGroup{Name: "text", FS: files, Patterns: []string{"text/*"}, Engine: TextEngine})
+	set.Insert(TemplateGroup{Name: "upper", FS: files, Patterns: []string{"upper/*"}, Engine: upperEngine{}})
+
+	if err := set.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		description    string
+		group          string
+		template       string
+		expectedResult string
+		expectedError  bool
+	}{
+		{
+			description:    "It should escape the data with the HTML engine",
+			group:          "html",
+			template:       "poema.html",
+			expectedResult: "<p>Galos &amp; manhã</p>",
+		},
+		{
+			description:    "It should keep the data as is with the text engine",
+			group:          "text",
+			template:       "poema.txt",
+			expectedResult: "Assunto: Galos & manhã morning",
+		},
+		{
+			description:    "It should execute the templates of another engine",
+			group:          "upper",
+			template:       "poema",
+			expectedResult: "TECENDO A MANHÃ",
+		},
+		{
+			description:   "It should fail for an unknown template",
+			group:         "text",
+			template:      "poema.html",
+			expectedError: true,
+		},
+	}
+
+	for i, item := range data {
+		var result bytes.Buffer
+		err := set.ExecuteTemplate(&result, item.group, item.template, "Galos & manhã")
+
+		if item.expectedError {
+			if err == nil {
+				t.Errorf("Item %d, “%s”: no errors found", i, item.description)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		} else if result.String() != item.expectedResult {
+			t.Errorf("Item %d, “%s”, wrong result. Expecting “%s”; found “%s”", i, item.description, item.expectedResult, result.String())
+		}
+	}
+
+	set.DefaultGroup = "text"
+	mux := NewMux()
+	mux.SetLogger(func(err error) { t.Error("Unexpected error:", err) })
+	mux.Register("/", func() Handler {
+		return &renderHandler{templates: set, template: "poema.txt", data: "Galos"}
+	})
+
+	if err := mux.ParseTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Wrong content type. Expecting “text/plain; charset=utf-8”; found “%s”", contentType)
+	}
+}
+
+func TestEnginePages(t *testing.T) {
+	files := fstest.MapFS{
+		"layout.html":  &fstest.MapFile{Data: []byte(`<h1>{{block "title" .}}Poemas{{end}}</h1>{{template "content" .}}`)},
+		"tecendo.html": &fstest.MapFile{Data: []byte(`{{define "title"}}Tecendo{{end}}{{define "content"}}{{.}}{{end}}`)},
+		"habitar.html": &fstest.MapFile{Data: []byte(`{{define "content"}}{{.}}{{end}}`)},
+	}
+
+	set := NewTemplateGroupSet(nil)
+	set.Insert(TemplateGroup{FS: files, Patterns: []string{"*.html"}})
+
+	if err := set.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	templ := set.elements[""].templ.(*goTemplates)
+
+	if len(templ.pages) != 0 {
+		t.Fatalf("Unexpected pages built when parsing: %d", len(templ.pages))
+	}
+
+	set.Layout = "layout.html"
+
+	for i := 0; i < 2; i++ {
+		for _, page := range []string{"tecendo.html", "habitar.html"} {
+			if err := set.ExecuteTemplate(io.Discard, "", page, "galo"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if len(templ.pages) != 2 {
+		t.Errorf("Wrong number of pages built. Expecting 2; found %d", len(templ.pages))
+	}
+
+	page := templ.pages[pageKey{"layout.html", "habitar.html"}]
+
+	if page.prototype.Lookup("tecendo.html") != nil {
+		t.Error("The page holds templates not reachable from the layout")
+	}
+}
+
+func TestEnginePageDefinitions(t *testing.T) {
+	files := fstest.MapFS{
+		"layout.html":   &fstest.MapFile{Data: []byte(`[{{block "title" .}}Poemas{{end}}] {{template "content" .}}{{template "footer"}}`)},
+		"partials.html": &fstest.MapFile{Data: []byte(`{{define "footer"}}.{{end}}`)},
+		"a.html":        &fstest.MapFile{Data: []byte(`{{define "title"}}A{{end}}{{define "content"}}secret A {{.}}{{end}}`)},
+		"b.html":        &fstest.MapFile{Data: []byte(`{{define "content"}}B {{.}}{{end}}`)},
+		"c.html":        &fstest.MapFile{Data: []byte(`{{define "title"}}C{{end}}`)},
+	}
+
+	set := NewTemplateGroupSet(nil)
+	set.Insert(TemplateGroup{FS: files, Patterns: []string{"*.html"}})
+	set.Layout = "layout.html"
+
+	if err := set.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		description    string
+		template       string
+		expectedResult string
+		expectedError  bool
+	}{
+		{
+			description:    "It should render the definitions of the page",
+			template:       "a.html",
+			expectedResult: "[A] secret A content.",
+		},
+		{
+			description:    "It should render the default of a block the page doesn’t define",
+			template:       "b.html",
+			expectedResult: "[Poemas] B content.",
+		},
+		{
+			description:   "It shouldn’t render a template defined by another page",
+			template:      "c.html",
+			expectedError: true,
+		},
+	}
+
+	for i, item := range data {
+		var result bytes.Buffer
+		err := set.ExecuteTemplate(&result, "", item.template, "content")
+
+		if item.expectedError {
+			if err == nil {
+				t.Errorf("Item %d, “%s”: no errors found", i, item.description)
+			} else if strings.Contains(result.String(), "secret") {
+				t.Errorf("Item %d, “%s”, another page leaked into the result: “%s”", i, item.description, result.String())
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		} else if result.String() != item.expectedResult {
+			t.Errorf("Item %d, “%s”, wrong result. Expecting “%s”; found “%s”", i, item.description, item.expectedResult, result.String())
+		}
+	}
+}
+
+func TestEngineFuncs(t *testing.T) {
+	files := fstest.MapFS{
+		"page.html":   &fstest.MapFile{Data: []byte(`{{template "header.html"}}, {{user}}`)},
+		"header.html": &fstest.MapFile{Data: []byte(`Olá`)},
+		"other.html":  &fstest.MapFile{Data: []byte(`{{user}}`)},
+	}
+
+	templates, err := HTMLEngine.Parse(
+		[]TemplateFile{{FS: files, Name: "page.html"}, {FS: files, Name: "header.html"}, {FS: files, Name: "other.html"}},
+		"", "", map[string]interface{}{"user": func() string { return "nobody" }},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			user := fmt.Sprintf("user%d", i)
+			funcs := map[string]interface{}{"user": func() string { return user }}
+
+			for j := 0; j < 10; j++ {
+				var result bytes.Buffer
+
+				if err := templates.ExecuteTemplate(&result, "", "page.html", nil, funcs); err != nil {
+					t.Error(err)
+				} else if result.String() != "Olá, "+user {
+					t.Errorf("Wrong result. Expecting “Olá, %s”; found “%s”", user, result.String())
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	var result bytes.Buffer
+
+	if err := templates.ExecuteTemplate(&result, "", "page.html", nil, nil); err != nil {
+		t.Fatal(err)
+	} else if result.String() != "Olá, nobody" {
+		t.Errorf("Wrong result. Expecting “Olá, nobody”; found “%s”", result.String())
+	}
+
+	page := templates.(*goTemplates).pages[pageKey{"", "page.html"}]
+
+	if page.prototype.Lookup("other.html") != nil {
+		t.Error("The copy holds templates not reachable from the page")
+	}
+}
+
+// upperEngine is an engine whose templates are written in upper case.
+type upperEngine struct{}
+
+func (upperEngine) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (upperEngine) Parse(files []TemplateFile, leftDelim, rightDelim string, funcs map[string]interface{}) (ParsedTemplates, error) {
+	templates := make(upperTemplates)
+
+	for _, file := range files {
+		content, err := file.ReadFile()
+
+		if err != nil {
+			return nil, err
+		}
+
+		templates[file.Base()] = strings.ToUpper(string(content))
+	}
+
+	return templates, nil
+}
+
+type upperTemplates map[string]string
+
+func (u upperTemplates) Defines(name string) bool {
+	_, found := u[name]
+	return found
+}
+
+func (u upperTemplates) ExecuteTemplate(w io.Writer, layout, name string, data interface{}, funcs map[string]interface{}) error {
+	_, err := io.WriteString(w, u[name])
+	return err
+}
@@ -0,0 +1,153 @@
+package trama
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is an error carrying the status code and the message to be shown
+// to the client, along with the error that caused it, which is not meant to be
+// shown. A handler can return an HTTPError to choose how the error is
+// presented by the Mux’s ErrorRenderer.
+type HTTPError struct {
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// Message is the public description of the error, safe to be shown to
+	// the client.
+	Message string
+
+	// Err is the cause of the error, if any.
+	Err error
+}
+
+// NewHTTPError creates an HTTPError with the given status code, public message
+// and cause. If the message is empty, the status text is used instead.
+func NewHTTPError(status int, message string, err error) *HTTPError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	return &HTTPError{Status: status, Message: message, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%d %s", e.Status, e.Message)
+	}
+
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Message, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// toHTTPError finds the HTTPError in the chain of err, or wraps err in a 500
+// (Internal Server Error) HTTPError if there is none.
+func toHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+
+	if errors.As(err, &httpErr) {
+		if httpErr.Status == 0 {
+			return NewHTTPError(http.StatusInternalServerError, httpErr.Message, httpErr.Err)
+		}
+
+		return httpErr
+	}
+
+	return NewHTTPError(http.StatusInternalServerError, "", err)
+}
+
+// PanicError is the error passed to the interceptors’ After methods when the
+// handler, or an interceptor, panics. It is then rendered as a 500 (Internal
+// Server Error) by the Mux’s ErrorRenderer.
+type PanicError struct {
+	// Value is the value recovered from the panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine at the moment of the panic.
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// An ErrorRenderer writes the response for an error returned by a handler, or
+// by an interceptor’s Before method, when nothing else was written. The status
+// code of the response is already set to the one of the error when
+// RenderError is called. See Mux’s ErrorRenderer field.
+type ErrorRenderer interface {
+	RenderError(Response, *http.Request, *HTTPError)
+}
+
+// TemplateErrorRenderer renders errors with templates chosen by the status
+// code. The templates are looked up in the handler’s TemplateGroupSet, so
+// they are usually registered in the Mux’s GlobalTemplates, and receive the
+// HTTPError as data.
+type TemplateErrorRenderer struct {
+	// Templates maps status codes to template names.
+	Templates map[int]string
+
+	// Default is the name of the template used for the status codes not
+	// present in Templates. If it is empty, only the status code is written.
+	Default string
+}
+
+// RenderError executes the template registered for the status code of the
+// error.
+func (t TemplateErrorRenderer) RenderError(res Response, r *http.Request, err *HTTPError) {
+	name, found := t.Templates[err.Status]
+
+	if !found {
+		name = t.Default
+	}
+
+	if name != "" {
+		res.ExecuteTemplate(name, err)
+	}
+}
+
+// Problem holds the problem details of an error, as defined by RFC 7807.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// ProblemEncoder encodes values as JSON, with the “application/problem+json”
+// media type defined by RFC 7807.
+var ProblemEncoder Encoder = problemEncoder{}
+
+type problemEncoder struct {
+	jsonEncoder
+}
+
+func (problemEncoder) ContentType() string {
+	return "application/problem+json"
+}
+
+// ProblemErrorRenderer renders errors as JSON problem details, as defined by
+// RFC 7807.
+type ProblemErrorRenderer struct{}
+
+// RenderError encodes the problem details of the error.
+func (ProblemErrorRenderer) RenderError(res Response, r *http.Request, err *HTTPError) {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(err.Status),
+		Status:   err.Status,
+		Instance: r.URL.Path,
+	}
+
+	if err.Message != problem.Title {
+		problem.Detail = err.Message
+	}
+
+	res.Encode(err.Status, ProblemEncoder, problem)
+}
@@ -0,0 +1,157 @@
+package trama
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorRenderer(t *testing.T) {
+	cause := errors.New("Um galo sozinho não tece uma manhã")
+
+	data := []struct {
+		description         string
+		renderer            ErrorRenderer
+		get                 func(Response) error
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			description: "It should write only the status code without a renderer",
+			get: func(res Response) error {
+				return NewHTTPError(http.StatusNotFound, "", cause)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			description: "It should render the template registered for the status code",
+			renderer: TemplateErrorRenderer{
+				Templates: map[int]string{http.StatusNotFound: "404"},
+				Default:   "erro",
+			},
+			get: func(res Response) error {
+				return fmt.Errorf("wrapped: %w", NewHTTPError(http.StatusNotFound, "Cadê o galo?", cause))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Não encontrado: Cadê o galo?",
+		},
+		{
+			description: "It should render the default template for an unknown error",
+			renderer: TemplateErrorRenderer{
+				Templates: map[int]string{http.StatusNotFound: "404"},
+				Default:   "erro",
+			},
+			get: func(res Response) error {
+				return cause
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Erro 500: Internal Server Error",
+		},
+		{
+			description: "It should write only the status code without a default template",
+			renderer:    TemplateErrorRenderer{},
+			get: func(res Response) error {
+				return NewHTTPError(http.StatusConflict, "", nil)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			description: "It should render the problem details",
+			renderer:    ProblemErrorRenderer{},
+			get: func(res Response) error {
+				return NewHTTPError(http.StatusUnprocessableEntity, "O galo precisa de outros galos", cause)
+			},
+			expectedStatus:      http.StatusUnprocessableEntity,
+			expectedContentType: "application/problem+json",
+			expectedBody:        `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"O galo precisa de outros galos","instance":"/uri"}` + "\n",
+		},
+		{
+			description: "It should render the problem details without the cause",
+			renderer:    ProblemErrorRenderer{},
+			get: func(res Response) error {
+				return cause
+			},
+			expectedStatus:      http.StatusInternalServerError,
+			expectedContentType: "application/problem+json",
+			expectedBody:        `{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/uri"}` + "\n",
+		},
+		{
+			description: "It shouldn't render the error when something was written",
+			renderer:    ProblemErrorRenderer{},
+			get: func(res Response) error {
+				res.Write([]byte("Tecendo a manhã"))
+				return cause
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Tecendo a manhã",
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+		set.Insert(TemplateGroup{})
+		templ := template.Must(template.New("404").Parse("Não encontrado: {{.Message}}"))
+		templ = template.Must(templ.New("erro").Parse("Erro {{.Status}}: {{.Message}}"))
+		set.elements[""].templ = &goTemplates{templ: htmlTemplate{templ}}
+
+		mux := NewMux()
+		mux.ErrorRenderer = item.renderer
+
+		handler := adapter{
+			handler: func() Handler {
+				return &statusHandler{get: item.get}
+			},
+			log: func(err error) {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			},
+			templates: set,
+			mux:       mux,
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if item.expectedContentType != "" && w.Header().Get("Content-Type") != item.expectedContentType {
+			t.Errorf("Item %d, “%s”, wrong content type. Expecting “%s”; found “%s”", i, item.description, item.expectedContentType, w.Header().Get("Content-Type"))
+		}
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”;\nfound “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("Tecendo a manhã")
+	err := NewHTTPError(http.StatusBadRequest, "", cause)
+
+	if err.Message != "Bad Request" {
+		t.Errorf("Unexpected message “%s”", err.Message)
+	}
+
+	if err.Error() != "400 Bad Request: Tecendo a manhã" {
+		t.Errorf("Unexpected error string “%s”", err.Error())
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("The cause can't be unwrapped")
+	}
+
+	if status := toHTTPError(&HTTPError{Message: "Sem status"}).Status; status != http.StatusInternalServerError {
+		t.Errorf("Unexpected status %d for an error without status", status)
+	}
+}
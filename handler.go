@@ -1,10 +1,18 @@
 package trama
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
 
 // Handler is the interface a trama handler must implement.
 type Handler interface {
-	// Get handles HTTP requests with a GET method
+	// Get handles HTTP requests with a GET method. It is also called for
+	// requests with a HEAD method, in which case the response body is
+	// discarded.
 	Get(Response, *http.Request) error
 
 	// Post handles HTTP requests with a POST method
@@ -20,6 +28,27 @@ type Handler interface {
 	Templates() TemplateGroupSet
 }
 
+// Putter is an optional interface a Handler can implement to handle HTTP
+// requests with a PUT method.
+type Putter interface {
+	// Put handles HTTP requests with a PUT method
+	Put(Response, *http.Request) error
+}
+
+// Patcher is an optional interface a Handler can implement to handle HTTP
+// requests with a PATCH method.
+type Patcher interface {
+	// Patch handles HTTP requests with a PATCH method
+	Patch(Response, *http.Request) error
+}
+
+// Deleter is an optional interface a Handler can implement to handle HTTP
+// requests with a DELETE method.
+type Deleter interface {
+	// Delete handles HTTP requests with a DELETE method
+	Delete(Response, *http.Request) error
+}
+
 // NopHandler is a facility for writing handlers. It is meant to be embedded in
 // your handler if you don’t need to implement all Handler methods.
 type NopHandler struct {
@@ -37,26 +66,118 @@ func (n *NopHandler) Templates() TemplateGroupSet {
 	return NewTemplateGroupSet(nil)
 }
 
+// allowedMethods lists the HTTP methods the handler is able to serve, in the
+// format expected by the Allow header.
+func allowedMethods(h Handler) string {
+	methods := []string{"GET", "HEAD", "POST"}
+
+	if _, ok := h.(Putter); ok {
+		methods = append(methods, "PUT")
+	}
+
+	if _, ok := h.(Patcher); ok {
+		methods = append(methods, "PATCH")
+	}
+
+	if _, ok := h.(Deleter); ok {
+		methods = append(methods, "DELETE")
+	}
+
+	methods = append(methods, "OPTIONS")
+	return strings.Join(methods, ", ")
+}
+
+type handlerKey struct{}
+
+// requestHandler returns the handler serving the request, so that an
+// interceptor can check the optional interfaces it implements.
+func requestHandler(r *http.Request) Handler {
+	handler, _ := r.Context().Value(handlerKey{}).(Handler)
+	return handler
+}
+
 type adapter struct {
 	handler   func() Handler
 	templates TemplateGroupSet
 	log       func(error)
+	mux       *Mux
+	pattern   string
+
+	// templatesErr is the error found when parsing the templates again in
+	// the development mode (see Mux’s Watch method).
+	templatesErr error
+	mutex        sync.RWMutex
+}
+
+func (a *adapter) setTemplates(templates TemplateGroupSet, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err == nil {
+		a.templates = templates
+	}
+
+	a.templatesErr = err
 }
 
-func (a adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (a *adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.RLock()
+	templates, templatesErr := a.templates, a.templatesErr
+	a.mutex.RUnlock()
+
+	if templatesErr != nil {
+		a.log(templatesErr)
+		http.Error(w, "Error parsing the templates:\n\n"+templatesErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "HEAD" {
+		w = headResponseWriter{w}
+	}
+
+	handler := a.handler()
+	r = r.WithContext(context.WithValue(r.Context(), handlerKey{}, handler))
+
 	response := &response{
 		responseWriter: w,
 		request:        r,
-		templates:      a.templates,
+		templates:      templates,
 		log:            a.log,
+		compress:       a.mux != nil && a.mux.Compress,
 	}
 
-	handler := a.handler()
-	interceptors := handler.Interceptors()
+	var interceptors InterceptorChain
 	var err error
 
+	// A method the handler can’t serve is answered before the interceptors,
+	// so that no resource is set up just to refuse the request. The answer is
+	// completed by the Mux’s Refuse function, if any.
+	if !serves(handler, r.Method) {
+		refuse(handler, response, r)
+
+		if a.mux != nil && a.mux.Refuse != nil {
+			err = a.protect(response, func() error {
+				a.mux.Refuse(response, r)
+				return nil
+			})
+		}
+
+		goto write
+	}
+
+	interceptors = handler.Interceptors()
+
 	for k, interceptor := range interceptors {
-		err = interceptor.Before(response, r)
+		if err = r.Context().Err(); err != nil {
+			interceptors = interceptors[:k]
+			goto write
+		}
+
+		err = a.protect(response, func() error {
+			return interceptor.Before(response, r)
+		})
+
+		r = response.request
 
 		if err != nil {
 			interceptors = interceptors[:k+1]
@@ -64,19 +185,180 @@ func (a adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	switch r.Method {
-	case "GET":
-		err = handler.Get(response, r)
-	case "POST":
-		err = handler.Post(response, r)
-	default:
-		response.returnStatus = http.StatusNotImplemented
+	if err = r.Context().Err(); err == nil {
+		err = a.protect(response, around(interceptors, handler, response))
+		r = response.request
 	}
 
 write:
 	for k := len(interceptors) - 1; k >= 0; k-- {
-		interceptors[k].After(response, r, err)
+		panicErr := a.protect(response, func() error {
+			interceptors[k].After(response, r, err)
+			return nil
+		})
+
+		if panicErr != nil {
+			err = panicErr
+		}
+	}
+
+	if response.failure != nil {
+		a.log(response.failure)
+		err = response.failure
+	}
+
+	if err != nil && !response.written {
+		a.renderError(response, r, err)
+	}
+
+	// The response is rendered before being written, so that an error in a
+	// template is written as any other error instead of a truncated page.
+	if err := response.render(); err != nil {
+		a.log(err)
+		response.discard()
+		a.renderError(response, r, err)
 	}
 
 	response.write()
 }
+
+// protect calls f, recovering from a panic and converting it into a
+// PanicError. As the response set so far can’t be trusted anymore, it is
+// discarded in favour of the error, unless it was already streamed. The Mux’s
+// Recover function, if any, is notified of the panic; otherwise the panic is
+// logged.
+func (a *adapter) protect(response *response, f func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicErr := &PanicError{Value: value, Stack: debug.Stack()}
+			err = panicErr
+			response.discard()
+
+			if a.mux != nil && a.mux.Recover != nil {
+				a.mux.Recover(value)
+			} else {
+				a.log(panicErr)
+			}
+		}
+	}()
+
+	return f()
+}
+
+// entityHeaders describe the body set by the handler, so they don’t apply to
+// the error replacing it.
+var entityHeaders = []string{
+	"Content-Type",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Length",
+	"ETag",
+}
+
+// renderError sets the response to the status code of the error and lets the
+// Mux’s ErrorRenderer, if any, write it. The headers describing the body the
+// handler set, such as Content-Type, are removed first.
+func (a *adapter) renderError(response *response, r *http.Request, err error) {
+	httpErr := toHTTPError(err)
+	header := response.responseWriter.Header()
+
+	for _, name := range entityHeaders {
+		header.Del(name)
+	}
+
+	response.SetStatus(httpErr.Status)
+
+	if a.mux != nil && a.mux.ErrorRenderer != nil {
+		a.mux.ErrorRenderer.RenderError(response, r, httpErr)
+	}
+}
+
+// around composes the Around methods of the interceptors implementing
+// AroundInterceptor with the call to the handler method.
+func around(interceptors InterceptorChain, handler Handler, response *response) func() error {
+	call := func() error {
+		return dispatch(handler, response, response.request)
+	}
+
+	for k := len(interceptors) - 1; k >= 0; k-- {
+		if interceptor, ok := interceptors[k].(AroundInterceptor); ok {
+			next := call
+			call = func() error {
+				return interceptor.Around(response, response.request, next)
+			}
+		}
+	}
+
+	return call
+}
+
+// serves tells whether the handler has a method to serve requests with the
+// given HTTP method.
+func serves(handler Handler, method string) bool {
+	switch method {
+	case "GET", "HEAD", "POST":
+		return true
+	case "PUT":
+		_, ok := handler.(Putter)
+		return ok
+	case "PATCH":
+		_, ok := handler.(Patcher)
+		return ok
+	case "DELETE":
+		_, ok := handler.(Deleter)
+		return ok
+	}
+
+	return false
+}
+
+// refuse answers a request whose method the handler can’t serve: an OPTIONS
+// request is answered with the allowed methods and any other one is set to
+// 405 (Method Not Allowed).
+func refuse(handler Handler, response *response, r *http.Request) {
+	response.SetHeader("Allow", allowedMethods(handler))
+
+	if r.Method == "OPTIONS" {
+		response.SetStatus(http.StatusOK)
+		return
+	}
+
+	response.SetStatus(http.StatusMethodNotAllowed)
+}
+
+// dispatch calls the handler method corresponding to the request method. The
+// request is refused if the method was changed along the interceptor chain to
+// one the handler can’t serve.
+func dispatch(handler Handler, response *response, r *http.Request) error {
+	switch r.Method {
+	case "GET", "HEAD":
+		return handler.Get(response, r)
+	case "POST":
+		return handler.Post(response, r)
+	case "PUT":
+		if putter, ok := handler.(Putter); ok {
+			return putter.Put(response, r)
+		}
+	case "PATCH":
+		if patcher, ok := handler.(Patcher); ok {
+			return patcher.Patch(response, r)
+		}
+	case "DELETE":
+		if deleter, ok := handler.(Deleter); ok {
+			return deleter.Delete(response, r)
+		}
+	}
+
+	refuse(handler, response, r)
+	return nil
+}
+
+// headResponseWriter discards the body written to the response, keeping only
+// its header, as expected in the response of a HEAD request.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (h headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
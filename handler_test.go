@@ -317,3 +317,435 @@ var (
 func (b *brokenBeforeInterceptor) Before(r Response, _ *http.Request) error {
 	return errorBrokenBefore
 }
+
+func TestMethods(t *testing.T) {
+	data := []struct {
+		description    string
+		handler        Handler
+		method         string
+		refuse         func(Response, *http.Request)
+		expectedStatus int
+		expectedBody   string
+		expectedAllow  string
+		expectedOrigin string
+	}{
+		{
+			description:    "It should call the Put method",
+			handler:        &restHandler{},
+			method:         "PUT",
+			expectedStatus: http.StatusSeeOther,
+		},
+		{
+			description:    "It should call the Patch method",
+			handler:        &restHandler{},
+			method:         "PATCH",
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		{
+			description:    "It should call the Delete method",
+			handler:        &restHandler{},
+			method:         "DELETE",
+			expectedStatus: http.StatusFound,
+		},
+		{
+			description:    "It should run Get and discard the body on HEAD",
+			handler:        &restHandler{},
+			method:         "HEAD",
+			expectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			description:    "It should answer OPTIONS with every implemented method",
+			handler:        &restHandler{},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		},
+		{
+			description:    "It should answer OPTIONS with only the basic methods",
+			handler:        &NopHandler{},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, HEAD, POST, OPTIONS",
+		},
+		{
+			description:    "It should refuse a method not implemented by the handler",
+			handler:        &NopHandler{},
+			method:         "DELETE",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD, POST, OPTIONS",
+		},
+		{
+			description:    "It should refuse an unknown method",
+			handler:        &restHandler{},
+			method:         "BREW",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		},
+		{
+			description:    "It should answer OPTIONS without calling the interceptors",
+			handler:        &brokenRestHandler{},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		},
+		{
+			description:    "It should refuse a method without calling the interceptors",
+			handler:        &brokenRestHandler{},
+			method:         "BREW",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		},
+		{
+			description: "It should let the Mux complete the answer to OPTIONS",
+			handler:     &brokenRestHandler{},
+			method:      "OPTIONS",
+			refuse: func(res Response, r *http.Request) {
+				res.SetHeader("Access-Control-Allow-Origin", "https://registro.br")
+				res.SetStatus(http.StatusNoContent)
+			},
+			expectedStatus: http.StatusNoContent,
+			expectedAllow:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+			expectedOrigin: "https://registro.br",
+		},
+		{
+			description: "It should recover from a panic when completing the answer",
+			handler:     &NopHandler{},
+			method:      "BREW",
+			refuse: func(res Response, r *http.Request) {
+				panic("galo")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedAllow:  "GET, HEAD, POST, OPTIONS",
+		},
+	}
+
+	for i, item := range data {
+		handler := adapter{
+			handler: func() Handler { return item.handler },
+			log:     func(err error) { t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err) },
+		}
+
+		if item.refuse != nil {
+			handler.mux = &Mux{Refuse: item.refuse, Recover: func(interface{}) {}}
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(item.method, "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+
+		if allow := w.Header().Get("Allow"); allow != item.expectedAllow {
+			t.Errorf("Item %d, “%s”, unexpected Allow header. Expecting “%s”; found “%s”", i, item.description, item.expectedAllow, allow)
+		}
+
+		if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != item.expectedOrigin {
+			t.Errorf("Item %d, “%s”, unexpected Access-Control-Allow-Origin header. Expecting “%s”; found “%s”", i, item.description, item.expectedOrigin, origin)
+		}
+	}
+}
+
+type restHandler struct {
+	NopHandler
+}
+
+func (h *restHandler) Get(res Response, req *http.Request) error {
+	res.Redirect("/get", http.StatusTemporaryRedirect)
+	return nil
+}
+
+func (h *restHandler) Put(res Response, req *http.Request) error {
+	res.Redirect("/put", http.StatusSeeOther)
+	return nil
+}
+
+func (h *restHandler) Patch(res Response, req *http.Request) error {
+	res.Redirect("/patch", http.StatusMovedPermanently)
+	return nil
+}
+
+func (h *restHandler) Delete(res Response, req *http.Request) error {
+	res.Redirect("/delete", http.StatusFound)
+	return nil
+}
+
+type brokenRestHandler struct {
+	restHandler
+}
+
+func (h *brokenRestHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(&brokenBeforeInterceptor{})
+}
+
+func TestStatus(t *testing.T) {
+	data := []struct {
+		description    string
+		get            func(Response) error
+		interceptors   InterceptorChain
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description: "It should render a template with the given status",
+			get: func(res Response) error {
+				res.SetStatus(http.StatusNotFound)
+				res.ExecuteTemplate("status", "Cadê?")
+				return nil
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Cadê?",
+		},
+		{
+			description: "It should keep the status set before encoding a payload",
+			get: func(res Response) error {
+				res.WriteJSON(http.StatusOK, "Ok")
+				res.SetStatus(http.StatusUnprocessableEntity)
+				return nil
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   "\"Ok\"\n",
+		},
+		{
+			description: "It should write only the status when nothing else was written",
+			get: func(res Response) error {
+				res.SetStatus(http.StatusNoContent)
+				return nil
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			description: "It should write 500 when nothing was written",
+			get: func(res Response) error {
+				return nil
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			description: "It should let an interceptor override the status",
+			get: func(res Response) error {
+				res.ExecuteTemplate("status", "Proibido")
+				return nil
+			},
+			interceptors:   InterceptorChain{&forbidInterceptor{}},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Proibido",
+		},
+		{
+			description: "It should forget the status of a replaced redirect",
+			get: func(res Response) error {
+				res.Redirect("/", http.StatusFound)
+				res.ExecuteTemplate("status", "Fica")
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Fica",
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+		set.Insert(TemplateGroup{})
+		set.elements[""].templ = &goTemplates{templ: htmlTemplate{template.Must(template.New("status").Parse("{{.}}"))}}
+
+		handler := adapter{
+			handler: func() Handler {
+				return &statusHandler{get: item.get, interceptors: item.interceptors}
+			},
+			log: func(err error) {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			},
+			templates: set,
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+type statusHandler struct {
+	NopHandler
+	get          func(Response) error
+	interceptors InterceptorChain
+}
+
+func (h *statusHandler) Get(res Response, req *http.Request) error {
+	return h.get(res)
+}
+
+func (h *statusHandler) Interceptors() InterceptorChain {
+	return h.interceptors
+}
+
+type forbidInterceptor struct {
+	NopInterceptor
+}
+
+func (i *forbidInterceptor) After(res Response, req *http.Request, err error) {
+	if res.Status() == http.StatusOK {
+		res.SetStatus(http.StatusForbidden)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	data := []struct {
+		description    string
+		panicIn        string
+		recoverDefined bool
+		expectedAfters int
+	}{
+		{
+			description:    "It should run every After when the handler panics",
+			panicIn:        "handler",
+			recoverDefined: true,
+			expectedAfters: 3,
+		},
+		{
+			description:    "It should log the panic when no Recover is defined",
+			panicIn:        "handler",
+			expectedAfters: 3,
+		},
+		{
+			description:    "It should run the After of the called interceptors when a Before panics",
+			panicIn:        "before",
+			recoverDefined: true,
+			expectedAfters: 2,
+		},
+		{
+			description:    "It should keep running the After chain when an After panics",
+			panicIn:        "after",
+			recoverDefined: true,
+			expectedAfters: 3,
+		},
+	}
+
+	for i, item := range data {
+		var recovered interface{}
+		var logged error
+		afters := make([]error, 0)
+
+		mux := NewMux()
+		mux.ErrorRenderer = ProblemErrorRenderer{}
+
+		if item.recoverDefined {
+			mux.Recover = func(r interface{}) { recovered = r }
+		}
+
+		handler := adapter{
+			handler: func() Handler {
+				return &panicHandler{panicIn: item.panicIn, afters: &afters}
+			},
+			log: func(err error) { logged = err },
+			mux: mux,
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, http.StatusInternalServerError, w.Code)
+		}
+
+		if w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("Item %d, “%s”, the error page wasn't rendered", i, item.description)
+		}
+
+		if len(afters) != item.expectedAfters {
+			t.Errorf("Item %d, “%s”, wrong number of After calls. Expecting %d; found %d", i, item.description, item.expectedAfters, len(afters))
+		}
+
+		for k, err := range afters {
+			if item.panicIn == "after" && k == 0 {
+				continue
+			}
+
+			if panicErr, ok := err.(*PanicError); !ok || panicErr.Value != item.panicIn || len(panicErr.Stack) == 0 {
+				t.Errorf("Item %d, “%s”, unexpected error in After %d: “%v”", i, item.description, k, err)
+			}
+		}
+
+		if item.recoverDefined {
+			if recovered != item.panicIn {
+				t.Errorf("Item %d, “%s”, Recover wasn't notified. Found “%v”", i, item.description, recovered)
+			}
+		} else if _, ok := logged.(*PanicError); !ok {
+			t.Errorf("Item %d, “%s”, the panic wasn't logged. Found “%v”", i, item.description, logged)
+		}
+	}
+}
+
+type panicHandler struct {
+	NopHandler
+	panicIn string
+	afters  *[]error
+}
+
+func (h *panicHandler) Get(res Response, req *http.Request) error {
+	res.ExecuteTemplate("galo", nil)
+
+	if h.panicIn == "handler" {
+		panic(h.panicIn)
+	}
+
+	return nil
+}
+
+func (h *panicHandler) Interceptors() InterceptorChain {
+	return InterceptorChain{
+		&panicInterceptor{afters: h.afters},
+		&panicInterceptor{afters: h.afters, panicInBefore: h.panicIn == "before"},
+		&panicInterceptor{afters: h.afters, panicInAfter: h.panicIn == "after"},
+	}
+}
+
+type panicInterceptor struct {
+	afters        *[]error
+	panicInBefore bool
+	panicInAfter  bool
+}
+
+func (p *panicInterceptor) Before(Response, *http.Request) error {
+	if p.panicInBefore {
+		panic("before")
+	}
+
+	return nil
+}
+
+func (p *panicInterceptor) After(res Response, req *http.Request, err error) {
+	*p.afters = append(*p.afters, err)
+
+	if p.panicInAfter {
+		panic("after")
+	}
+}
@@ -15,6 +15,22 @@ type Interceptor interface {
 	After(Response, *http.Request, error)
 }
 
+// An AroundInterceptor wraps the call to the handler method in a single stack
+// frame, which is useful for things like deferring the measure of the
+// handler’s duration, recovering only from the handler’s panics, running the
+// handler inside a database transaction closure or retrying it. An
+// interceptor in an InterceptorChain implementing AroundInterceptor has its
+// Around method called after every Before method, in the order of the chain:
+// the Around of the first interceptor receives as next the Around of the
+// second one, and so forth, until the last one, which receives the handler
+// method itself. An interceptor only needing Around can embed NopInterceptor.
+type AroundInterceptor interface {
+	// Around must call next to continue the chain, returning the error that
+	// will be passed to the After methods. If next is not called, neither
+	// the subsequent Around methods nor the handler method are called.
+	Around(res Response, r *http.Request, next func() error) error
+}
+
 // InterceptorChain is a sequence of interceptors. Each interceptor has its
 // Before method called, in order, before the handler is executed, and has its
 // After method called, in reverse order, after it. Any Before method returning
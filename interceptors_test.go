@@ -0,0 +1,393 @@
+package trama
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestInterceptorContext(t *testing.T) {
+	data := []struct {
+		description   string
+		cancelAt      int
+		expectedCalls []string
+		expectedErr   error
+		expectedValue string
+	}{
+		{
+			description: "It should pass the derived request along the chain",
+			cancelAt:    -1,
+			expectedCalls: []string{
+				"a.Before", "b.Before", "c.Before", "handler", "c.After", "b.After", "a.After",
+			},
+			expectedValue: "a, b, c",
+		},
+		{
+			description: "It should stop the chain when the context is cancelled",
+			cancelAt:    1,
+			expectedCalls: []string{
+				"a.Before", "b.Before", "b.After", "a.After",
+			},
+			expectedErr:   context.Canceled,
+			expectedValue: "a, b",
+		},
+		{
+			description: "It should stop before the handler when the context is cancelled",
+			cancelAt:    2,
+			expectedCalls: []string{
+				"a.Before", "b.Before", "c.Before", "c.After", "b.After", "a.After",
+			},
+			expectedErr:   context.Canceled,
+			expectedValue: "a, b, c",
+		},
+	}
+
+	for i, item := range data {
+		var calls []string
+		var errs []error
+		var values []string
+
+		handler := adapter{
+			handler: func() Handler {
+				h := &contextHandler{calls: &calls}
+
+				for k, name := range []string{"a", "b", "c"} {
+					h.interceptors = append(h.interceptors, &contextInterceptor{
+						name:   name,
+						cancel: k == item.cancelAt,
+						calls:  &calls,
+						errs:   &errs,
+						values: &values,
+					})
+				}
+
+				return h
+			},
+			log: func(err error) {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			},
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if !reflect.DeepEqual(calls, item.expectedCalls) {
+			t.Errorf("Item %d, “%s”, unexpected calls. Expecting %v; found %v", i, item.description, item.expectedCalls, calls)
+		}
+
+		for _, err := range errs {
+			if err != item.expectedErr {
+				t.Errorf("Item %d, “%s”, unexpected error in After. Expecting “%v”; found “%v”", i, item.description, item.expectedErr, err)
+			}
+		}
+
+		for _, value := range values {
+			if value != item.expectedValue {
+				t.Errorf("Item %d, “%s”, unexpected context value in After. Expecting “%s”; found “%s”", i, item.description, item.expectedValue, value)
+			}
+		}
+	}
+}
+
+type contextKey struct{}
+
+type contextInterceptor struct {
+	name   string
+	cancel bool
+	calls  *[]string
+	errs   *[]error
+	values *[]string
+}
+
+func (c *contextInterceptor) Before(res Response, r *http.Request) error {
+	*c.calls = append(*c.calls, c.name+".Before")
+	value, _ := r.Context().Value(contextKey{}).(string)
+
+	if value != "" {
+		value += ", "
+	}
+
+	ctx := context.WithValue(r.Context(), contextKey{}, value+c.name)
+
+	if c.cancel {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		cancel()
+	}
+
+	res.WithContext(ctx)
+	return nil
+}
+
+func (c *contextInterceptor) After(res Response, r *http.Request, err error) {
+	*c.calls = append(*c.calls, c.name+".After")
+	*c.errs = append(*c.errs, err)
+	value, _ := r.Context().Value(contextKey{}).(string)
+	*c.values = append(*c.values, value)
+}
+
+type contextHandler struct {
+	NopHandler
+	calls        *[]string
+	interceptors InterceptorChain
+}
+
+func (h *contextHandler) Get(res Response, r *http.Request) error {
+	*h.calls = append(*h.calls, "handler")
+
+	if value := r.Context().Value(contextKey{}); value != "a, b, c" {
+		return NewHTTPError(http.StatusBadRequest, "", nil)
+	}
+
+	res.Write([]byte("ok"))
+	return nil
+}
+
+func (h *contextHandler) Interceptors() InterceptorChain {
+	return h.interceptors
+}
+
+func TestAroundInterceptor(t *testing.T) {
+	data := []struct {
+		description   string
+		interceptors  func(calls *[]string) InterceptorChain
+		failures      int
+		expectedCalls []string
+		expectedErr   bool
+	}{
+		{
+			description: "It should nest the Around methods in the chain order",
+			interceptors: func(calls *[]string) InterceptorChain {
+				return InterceptorChain{
+					&aroundInterceptor{name: "a", calls: calls},
+					&struct{ NopInterceptor }{},
+					&aroundInterceptor{name: "c", calls: calls},
+				}
+			},
+			expectedCalls: []string{
+				"a.Before", "c.Before",
+				"a.Around", "c.Around", "handler", "c.Around done", "a.Around done",
+				"c.After", "a.After",
+			},
+		},
+		{
+			description: "It should let an Around method retry the handler",
+			interceptors: func(calls *[]string) InterceptorChain {
+				return InterceptorChain{
+					&aroundInterceptor{name: "a", calls: calls, retries: 2},
+				}
+			},
+			failures: 2,
+			expectedCalls: []string{
+				"a.Before",
+				"a.Around", "handler", "handler", "handler", "a.Around done",
+				"a.After",
+			},
+		},
+		{
+			description: "It should pass the error of the last retry to After",
+			interceptors: func(calls *[]string) InterceptorChain {
+				return InterceptorChain{
+					&aroundInterceptor{name: "a", calls: calls, retries: 1},
+				}
+			},
+			failures: 2,
+			expectedCalls: []string{
+				"a.Before",
+				"a.Around", "handler", "handler", "a.Around done",
+				"a.After",
+			},
+			expectedErr: true,
+		},
+		{
+			description: "It should skip the handler when next isn't called",
+			interceptors: func(calls *[]string) InterceptorChain {
+				return InterceptorChain{
+					&aroundInterceptor{name: "a", calls: calls},
+					&aroundInterceptor{name: "b", calls: calls, skip: true},
+					&aroundInterceptor{name: "c", calls: calls},
+				}
+			},
+			expectedCalls: []string{
+				"a.Before", "b.Before", "c.Before",
+				"a.Around", "b.Around", "b.Around done", "a.Around done",
+				"c.After", "b.After", "a.After",
+			},
+		},
+	}
+
+	for i, item := range data {
+		var calls []string
+		var afterErr error
+
+		handler := adapter{
+			handler: func() Handler {
+				return &retryHandler{
+					calls:        &calls,
+					failures:     item.failures,
+					interceptors: item.interceptors(&calls),
+					afterErr:     &afterErr,
+				}
+			},
+			log: func(err error) {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			},
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if !reflect.DeepEqual(calls, item.expectedCalls) {
+			t.Errorf("Item %d, “%s”, unexpected calls. Expecting %v; found %v", i, item.description, item.expectedCalls, calls)
+		}
+
+		if (afterErr != nil) != item.expectedErr {
+			t.Errorf("Item %d, “%s”, unexpected error in After: “%v”", i, item.description, afterErr)
+		}
+	}
+}
+
+type aroundInterceptor struct {
+	name    string
+	calls   *[]string
+	retries int
+	skip    bool
+}
+
+func (a *aroundInterceptor) Before(res Response, r *http.Request) error {
+	*a.calls = append(*a.calls, a.name+".Before")
+	return nil
+}
+
+func (a *aroundInterceptor) After(res Response, r *http.Request, err error) {
+	*a.calls = append(*a.calls, a.name+".After")
+}
+
+func (a *aroundInterceptor) Around(res Response, r *http.Request, next func() error) (err error) {
+	*a.calls = append(*a.calls, a.name+".Around")
+	defer func() { *a.calls = append(*a.calls, a.name+".Around done") }()
+
+	if a.skip {
+		return nil
+	}
+
+	for k := 0; k <= a.retries; k++ {
+		if err = next(); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+type retryHandler struct {
+	NopHandler
+	calls        *[]string
+	failures     int
+	interceptors InterceptorChain
+	afterErr     *error
+}
+
+func (h *retryHandler) Get(res Response, r *http.Request) error {
+	*h.calls = append(*h.calls, "handler")
+
+	if h.failures > 0 {
+		h.failures--
+		return NewHTTPError(http.StatusConflict, "", nil)
+	}
+
+	res.Write([]byte("ok"))
+	return nil
+}
+
+func (h *retryHandler) Interceptors() InterceptorChain {
+	return append(h.interceptors, &errorRecorder{err: h.afterErr})
+}
+
+type errorRecorder struct {
+	NopInterceptor
+	err *error
+}
+
+func (e *errorRecorder) After(res Response, r *http.Request, err error) {
+	*e.err = err
+}
+
+func TestFail(t *testing.T) {
+	var logged []error
+
+	handler := adapter{
+		handler: func() Handler {
+			return &failHandler{}
+		},
+		log: func(err error) { logged = append(logged, err) },
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Wrong status code. Expecting %d; found %d", http.StatusInternalServerError, w.Code)
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("The response of the handler wasn’t replaced: “%s”", w.Body.String())
+	}
+
+	if len(logged) != 1 || logged[0] != errorBrokenAfter {
+		t.Errorf("The failure wasn’t logged: %v", logged)
+	}
+}
+
+type failHandler struct {
+	NopHandler
+}
+
+func (h *failHandler) Get(res Response, r *http.Request) error {
+	res.Write([]byte("ok"))
+	return nil
+}
+
+func (h *failHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(&wrappingInterceptor{&failInterceptor{}})
+}
+
+// wrappingInterceptor calls another interceptor with a wrapped Response.
+type wrappingInterceptor struct {
+	Interceptor
+}
+
+type wrappedResponse struct {
+	Response
+}
+
+func (w *wrappingInterceptor) Before(res Response, r *http.Request) error {
+	return w.Interceptor.Before(wrappedResponse{res}, r)
+}
+
+func (w *wrappingInterceptor) After(res Response, r *http.Request, err error) {
+	w.Interceptor.After(wrappedResponse{res}, r, err)
+}
+
+type failInterceptor struct {
+	NopInterceptor
+}
+
+func (f *failInterceptor) After(res Response, r *http.Request, err error) {
+	res.Fail(errorBrokenAfter)
+}
@@ -0,0 +1,162 @@
+package trama
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguageInterceptor chooses the template group of the response by
+// negotiating the language of the request: the languages accepted by the
+// client, in the Accept-Language header, are matched against the names of the
+// registered template groups, which are expected to be language tags like
+// “pt-BR” or “en”, using the lookup scheme of RFC 4647. The chosen language
+// can be overridden by a query string parameter or by a cookie. As the
+// response depends on the request headers, they are added to the Vary header.
+type LanguageInterceptor struct {
+	NopInterceptor
+
+	// Query is the name of an optional query string parameter holding the
+	// language, which prevails over the cookie and the Accept-Language
+	// header.
+	Query string
+
+	// Cookie is the name of an optional cookie holding the language, which
+	// prevails over the Accept-Language header.
+	Cookie string
+
+	// Default is the name of the group chosen when no language matches. If
+	// it is empty, the template group of the response is left untouched, so
+	// the set’s default group is used.
+	Default string
+}
+
+// Before sets the template group of the response to the negotiated language.
+func (l *LanguageInterceptor) Before(res Response, r *http.Request) error {
+	groups := res.TemplateGroups()
+	addVary(res.Header(), "Accept-Language")
+
+	if l.Query != "" {
+		if value := r.URL.Query().Get(l.Query); value != "" {
+			if group, found := MatchLanguage(value, groups); found {
+				res.SetTemplateGroup(group)
+				return nil
+			}
+		}
+	}
+
+	if l.Cookie != "" {
+		addVary(res.Header(), "Cookie")
+
+		if cookie, err := r.Cookie(l.Cookie); err == nil && cookie.Value != "" {
+			if group, found := MatchLanguage(cookie.Value, groups); found {
+				res.SetTemplateGroup(group)
+				return nil
+			}
+		}
+	}
+
+	if group, found := MatchLanguage(r.Header.Get("Accept-Language"), groups); found {
+		res.SetTemplateGroup(group)
+	} else if l.Default != "" {
+		res.SetTemplateGroup(l.Default)
+	}
+
+	return nil
+}
+
+// MatchLanguage finds the best of the available language tags for a list of
+// language ranges in the format of the Accept-Language header, using the
+// lookup scheme of RFC 4647: the ranges are tried in order of preference and,
+// when a range doesn’t match any tag, its subtags are removed from the end
+// until it does. The comparison is case-insensitive; the tag is returned as
+// found in the available ones.
+func MatchLanguage(ranges string, available []string) (string, bool) {
+	for _, languageRange := range parseLanguageRanges(ranges) {
+		for languageRange != "" {
+			for _, tag := range available {
+				if strings.EqualFold(tag, languageRange) {
+					return tag, true
+				}
+			}
+
+			k := strings.LastIndex(languageRange, "-")
+
+			if k < 0 {
+				break
+			}
+
+			languageRange = languageRange[:k]
+
+			// A single-letter subtag, like the “x” of private use
+			// subtags, doesn’t stand by itself.
+			if k = strings.LastIndex(languageRange, "-"); k >= 0 && len(languageRange)-k == 2 {
+				languageRange = languageRange[:k]
+			}
+		}
+	}
+
+	return "", false
+}
+
+// parseLanguageRanges parses a list of language ranges, sorting them by their
+// quality values. The ranges with a zero quality and the wildcard, which is
+// ignored by the lookup scheme, are discarded.
+func parseLanguageRanges(header string) []string {
+	type weightedRange struct {
+		languageRange string
+		quality       float64
+	}
+
+	var ranges []weightedRange
+
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		languageRange := strings.TrimSpace(parts[0])
+		quality := 1.0
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if languageRange == "" || languageRange == "*" || quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, weightedRange{languageRange, quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	result := make([]string, len(ranges))
+
+	for i, r := range ranges {
+		result[i] = r.languageRange
+	}
+
+	return result
+}
+
+// addVary adds the header name to the Vary header, unless it is already there.
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.TrimSpace(token)
+
+			if token == "*" || strings.EqualFold(token, name) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", name)
+}
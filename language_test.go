@@ -0,0 +1,236 @@
+package trama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMatchLanguage(t *testing.T) {
+	available := []string{"pt-BR", "pt", "en", "zh-Hant"}
+
+	data := []struct {
+		description   string
+		ranges        string
+		expectedTag   string
+		expectedFound bool
+	}{
+		{
+			description:   "It should match a tag exactly, ignoring the case",
+			ranges:        "PT-br",
+			expectedTag:   "pt-BR",
+			expectedFound: true,
+		},
+		{
+			description:   "It should truncate the range until it matches",
+			ranges:        "en-GB",
+			expectedTag:   "en",
+			expectedFound: true,
+		},
+		{
+			description:   "It should remove a single-letter subtag along with the one after it",
+			ranges:        "zh-Hant-x-private",
+			expectedTag:   "zh-Hant",
+			expectedFound: true,
+		},
+		{
+			description:   "It should follow the quality values",
+			ranges:        "en;q=0.5, pt-PT;q=0.8, fr",
+			expectedTag:   "pt",
+			expectedFound: true,
+		},
+		{
+			description:   "It should keep the header order for equal qualities",
+			ranges:        "en, pt-BR",
+			expectedTag:   "en",
+			expectedFound: true,
+		},
+		{
+			description:   "It should ignore the ranges not acceptable",
+			ranges:        "en;q=0, pt-BR;q=0.1",
+			expectedTag:   "pt-BR",
+			expectedFound: true,
+		},
+		{
+			description: "It should ignore the wildcard",
+			ranges:      "fr, *",
+		},
+		{
+			description: "It shouldn't match an empty header",
+			ranges:      "",
+		},
+	}
+
+	for i, item := range data {
+		tag, found := MatchLanguage(item.ranges, available)
+
+		if tag != item.expectedTag || found != item.expectedFound {
+			t.Errorf("Item %d, “%s”, wrong match. Expecting “%s” (%t); found “%s” (%t)", i, item.description, item.expectedTag, item.expectedFound, tag, found)
+		}
+	}
+}
+
+func TestLanguageInterceptor(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pt/poema.html": {Data: []byte("Tecendo a manhã")},
+		"en/poema.html": {Data: []byte("Weaving the morning")},
+		"es/poema.html": {Data: []byte("Tejiendo la mañana")},
+	}
+
+	data := []struct {
+		description    string
+		interceptor    *LanguageInterceptor
+		uri            string
+		acceptLanguage string
+		cookie         *http.Cookie
+		vary           string
+		expectedVary   []string
+		expectedBody   string
+	}{
+		{
+			description:    "It should choose the group from the Accept-Language header",
+			interceptor:    &LanguageInterceptor{},
+			uri:            "/",
+			acceptLanguage: "en-US, pt;q=0.9",
+			expectedVary:   []string{"Accept-Language"},
+			expectedBody:   "Weaving the morning",
+		},
+		{
+			description:    "It should let the cookie override the header",
+			interceptor:    &LanguageInterceptor{Cookie: "lang"},
+			uri:            "/",
+			acceptLanguage: "en",
+			cookie:         &http.Cookie{Name: "lang", Value: "es"},
+			expectedVary:   []string{"Accept-Language", "Cookie"},
+			expectedBody:   "Tejiendo la mañana",
+		},
+		{
+			description:    "It should let the query override the cookie",
+			interceptor:    &LanguageInterceptor{Cookie: "lang", Query: "lang"},
+			uri:            "/?lang=pt-BR",
+			acceptLanguage: "en",
+			cookie:         &http.Cookie{Name: "lang", Value: "es"},
+			expectedVary:   []string{"Accept-Language"},
+			expectedBody:   "Tecendo a manhã",
+		},
+		{
+			description:    "It should ignore an unknown override",
+			interceptor:    &LanguageInterceptor{Query: "lang"},
+			uri:            "/?lang=fr",
+			acceptLanguage: "es",
+			expectedVary:   []string{"Accept-Language"},
+			expectedBody:   "Tejiendo la mañana",
+		},
+		{
+			description:    "It should use the default group when nothing matches",
+			interceptor:    &LanguageInterceptor{Default: "pt"},
+			uri:            "/",
+			acceptLanguage: "fr",
+			expectedVary:   []string{"Accept-Language"},
+			expectedBody:   "Tecendo a manhã",
+		},
+		{
+			description:    "It shouldn't repeat a header already in Vary",
+			interceptor:    &LanguageInterceptor{},
+			uri:            "/",
+			acceptLanguage: "en",
+			vary:           "Origin, accept-language",
+			expectedVary:   []string{"Origin, accept-language"},
+			expectedBody:   "Weaving the morning",
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+
+		for _, name := range []string{"pt", "en", "es"} {
+			set.Insert(TemplateGroup{Name: name, Patterns: []string{name + "/*.html"}, FS: fsys})
+		}
+
+		set.DefaultGroup = "en"
+
+		handler := &languageHandler{
+			templates:    set,
+			interceptors: InterceptorChain{item.interceptor},
+			vary:         item.vary,
+		}
+
+		mux := NewMux()
+		mux.SetLogger(func(err error) {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		})
+
+		mux.Register("/", func() Handler { return handler })
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := http.NewRequest("GET", item.uri, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Accept-Language", item.acceptLanguage)
+
+		if item.cookie != nil {
+			r.AddCookie(item.cookie)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if body := w.Body.String(); body != item.expectedBody {
+			t.Errorf("Item %d, “%s”, wrong body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, body)
+		}
+
+		vary := w.Header().Values("Vary")
+
+		if len(vary) != len(item.expectedVary) {
+			t.Errorf("Item %d, “%s”, wrong Vary header. Expecting %v; found %v", i, item.description, item.expectedVary, vary)
+			continue
+		}
+
+		for k := range vary {
+			if vary[k] != item.expectedVary[k] {
+				t.Errorf("Item %d, “%s”, wrong Vary header. Expecting %v; found %v", i, item.description, item.expectedVary, vary)
+			}
+		}
+	}
+}
+
+type languageHandler struct {
+	NopHandler
+	templates    TemplateGroupSet
+	interceptors InterceptorChain
+	vary         string
+}
+
+func (h *languageHandler) Interceptors() InterceptorChain {
+	if h.vary == "" {
+		return h.interceptors
+	}
+
+	return append(InterceptorChain{&varyInterceptor{vary: h.vary}}, h.interceptors...)
+}
+
+func (h *languageHandler) Templates() TemplateGroupSet {
+	return h.templates
+}
+
+func (h *languageHandler) Get(res Response, r *http.Request) error {
+	res.ExecuteTemplate("poema.html", nil)
+	return nil
+}
+
+type varyInterceptor struct {
+	NopInterceptor
+	vary string
+}
+
+func (v *varyInterceptor) Before(res Response, r *http.Request) error {
+	res.SetHeader("Vary", v.vary)
+	return nil
+}
@@ -3,6 +3,7 @@ package trama
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"sync"
 )
 
@@ -11,39 +12,62 @@ import (
 //
 // A basic example server can be:
 //
-// 	package main
+//	package main
 //
-// 	import (
-// 		"fmt"
-// 		"net/http"
+//	import (
+//		"fmt"
+//		"net/http"
 //
-// 		"github.com/registrobr/trama"
-// 	)
+//		"github.com/registrobr/trama"
+//	)
 //
-// 	type handler struct {
-// 		trama.NopHandler
-// 	}
+//	type handler struct {
+//		trama.NopHandler
+//	}
 //
-// 	func main() {
-// 		mux := trama.NewMux()
-// 		mux.Register("/", func() trama.Handler { return &handler{} })
-// 		err := http.ListenAndServe(":12345", mux)
+//	func main() {
+//		mux := trama.NewMux()
+//		mux.Register("/", func() trama.Handler { return &handler{} })
+//		err := http.ListenAndServe(":12345", mux)
 //
-// 		if err != nil {
-// 			fmt.Println(err)
-// 		}
-// 	}
+//		if err != nil {
+//			fmt.Println(err)
+//		}
+//	}
 type Mux struct {
 	// Recover specifies an optional function to be called if the goroutine
-	// handling the request panics.
+	// handling the request panics. A panic in the handler or in one of its
+	// interceptors is recovered in the scope of the request, converted into
+	// a PanicError passed to the interceptors’ After methods and then written
+	// by the ErrorRenderer, so Recover is only a notification. If Recover is
+	// nil, the panic is logged.
 	Recover func(interface{})
 
 	// GlobalTemplates stores every HTML template not specific to some handler,
 	// such as headers and footers one would use in every page.
 	GlobalTemplates TemplateGroupSet
 
+	// ErrorRenderer specifies an optional renderer to write the response when
+	// a handler, or an interceptor’s Before method, returns an error and
+	// nothing else was written. If it is nil, only the status code of the
+	// error is written.
+	ErrorRenderer ErrorRenderer
+
+	// Refuse specifies an optional function to complete the answer to an
+	// OPTIONS request, or to a request with a method the handler can’t serve,
+	// which already holds the Allow header and the status code. As these
+	// requests are answered without calling the interceptors, Refuse is the
+	// place for the headers every answer needs, such as the Access-Control
+	// headers of a CORS preflight request.
+	Refuse func(res Response, r *http.Request)
+
+	// Compress enables the gzip compression of the responses, except the
+	// streamed ones, for the clients accepting it. Only textual bodies with
+	// at least 1 KiB are compressed.
+	Compress bool
+
 	mutex      sync.RWMutex
-	mux        *http.ServeMux
+	router     *router
 	log        func(error)
 	leftDelim  string
 	rightDelim string
@@ -53,8 +77,8 @@ type Mux struct {
 // NewMux constructs a new trama multiplexer.
 func NewMux() *Mux {
 	return &Mux{
-		mux: http.NewServeMux(),
-		log: func(err error) { println(err.Error()) },
+		router: newRouter(),
+		log:    func(err error) { println(err.Error()) },
 	}
 }
 
@@ -67,10 +91,32 @@ func (t *Mux) SetLogger(logger func(error)) {
 // Register registers a handler constructor to be called upon a request arrival
 // at the specified URI. The new handler made by this constructor is then used
 // to handle the request.
+//
+// The URI is a pattern matched against the request path, segment by segment.
+// A segment can be a literal, a named parameter like “{name}”, a named
+// parameter constrained by a regular expression like “{id:[0-9]+}” or, as the
+// last segment, a wildcard like “{path...}” matching the rest of the path. As
+// in http.ServeMux, a pattern ending in a slash matches the whole subtree
+// rooted at it. The captured values are available through Response’s Param
+// method and the PathParams function. Unlike in http.ServeMux, the pattern
+// can’t be qualified by a host name.
+//
+// As in http.ServeMux, a request whose path has “.” or “..” elements or
+// repeated slashes is redirected to the canonical path, and a request for a
+// subtree without its trailing slash is redirected to it. A parameter or a
+// wildcard never captures a “..” element, even one hidden by an escaped
+// slash.
+//
+// When more than one pattern matches a path, the first segment where they
+// differ decides: a literal wins over a constrained parameter, which wins
+// over an unconstrained parameter, which wins over a wildcard. Constrained
+// parameters are tried in the order they were registered. Register panics if
+// the pattern is invalid or matches exactly the same paths of a pattern
+// already registered.
 func (t *Mux) Register(uri string, h func() Handler) {
-	a := &adapter{handler: h, log: t.log}
+	a := &adapter{handler: h, log: t.log, mux: t, pattern: uri}
 	t.handlers = append(t.handlers, a)
-	t.mux.Handle(uri, a)
+	t.router.handle(uri, a)
 }
 
 // SetTemplateDelims sets the delimiters used when parsing the registered
@@ -89,25 +135,62 @@ func (t *Mux) ParseTemplates() error {
 	defer t.mutex.Unlock()
 
 	for _, h := range t.handlers {
-		set := h.handler().Templates()
-		err := set.union(t.GlobalTemplates)
+		set, err := t.parseTemplates(h)
 
 		if err != nil {
 			return err
 		}
 
-		err = set.parse(t.leftDelim, t.rightDelim)
+		h.setTemplates(set, nil)
+	}
 
-		if err != nil {
-			return err
+	return nil
+}
+
+// Validate checks the templates parsed by ParseTemplates, so that mistakes
+// are found at startup instead of when a request arrives. For each handler,
+// every group of its TemplateGroupSet, along with the global templates, must
+// define the same templates, by itself or by its fallbacks (see
+// TemplateGroup’s Fallback field), and the templates called with
+// {{template}} must be defined. All the problems found are reported in a
+// TemplateErrors.
+func (t *Mux) Validate() error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var errs TemplateErrors
+
+	for _, h := range t.handlers {
+		h.mutex.RLock()
+		templates := h.templates
+		h.mutex.RUnlock()
+
+		for _, err := range templates.validate() {
+			errs = append(errs, fmt.Errorf("Handler “%s”: %s", h.pattern, err))
 		}
+	}
 
-		h.templates = set
+	if len(errs) > 0 {
+		return errs
 	}
 
 	return nil
 }
 
+// parseTemplates parses the templates of the handler along with the global
+// templates.
+func (t *Mux) parseTemplates(h *adapter) (TemplateGroupSet, error) {
+	set := h.handler().Templates()
+	err := set.union(t.GlobalTemplates)
+
+	if err != nil {
+		return set, err
+	}
+
+	err = set.parse(t.leftDelim, t.rightDelim)
+	return set, err
+}
+
 // ServeHTTP implements the http.Handler interface. This way, Mux can be passed
 // as an argument to the http.ListenAndServe function.
 func (t *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -123,5 +206,39 @@ func (t *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	t.mux.ServeHTTP(w, r)
+	// As in http.ServeMux, a path that isn’t in its canonical form is
+	// redirected, so that “..” elements can’t escape the matched pattern.
+	if r.Method != "CONNECT" {
+		if p := cleanPath(r.URL.Path); p != r.URL.Path {
+			u := &url.URL{Path: p, RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	handler, params, redirect := t.router.match(r.URL.EscapedPath())
+
+	// A subtree requested without its trailing slash is redirected to it, as
+	// in http.ServeMux.
+	if redirect {
+		u := &url.URL{Path: r.URL.Path + "/", RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+
+		if u.RawPath != "" {
+			u.RawPath += "/"
+		}
+
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return
+	}
+
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if params != nil {
+		r = withPathParams(r, params)
+	}
+
+	handler.ServeHTTP(w, r)
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"testing/fstest"
 )
 
 func TestMuxServeHTTP(t *testing.T) {
@@ -250,3 +251,120 @@ func (h *crazyHandler) Interceptors() InterceptorChain {
 func (h *crazyHandler) Templates() TemplateGroupSet {
 	return NewTemplateGroupSet(nil)
 }
+
+func TestMuxValidate(t *testing.T) {
+	files := fstest.MapFS{
+		"global/header.html": &fstest.MapFile{Data: []byte(`Tecendo a manhã`)},
+		"en/poem.html":       &fstest.MapFile{Data: []byte(`{{template "header.html"}} {{template "rooster"}}`)},
+		"en/rooster.html":    &fstest.MapFile{Data: []byte(`{{define "rooster"}}A rooster{{end}}`)},
+		"pt/poema.html":      &fstest.MapFile{Data: []byte(`{{template "header.html"}} Um galo`)},
+		"pt/poem.html":       &fstest.MapFile{Data: []byte(`{{template "header.html"}} {{template "galo"}}`)},
+		"pt-BR/poem.html":    &fstest.MapFile{Data: []byte(`{{template "header.html"}} Um galo sozinho`)},
+	}
+
+	data := []struct {
+		description    string
+		groups         []TemplateGroup
+		defaultGroup   string
+		expectedErrors []string
+	}{
+		{
+			description: "It should accept groups defining the same templates",
+			groups: []TemplateGroup{
+				{Name: "en", FS: files, Patterns: []string{"en/*.html"}},
+				{Name: "pt-BR", FS: files, Patterns: []string{"pt-BR/*.html", "en/rooster.html"}},
+			},
+		},
+		{
+			description: "It should accept the templates defined by the fallbacks",
+			groups: []TemplateGroup{
+				{Name: "en", FS: files, Patterns: []string{"en/*.html"}},
+				{Name: "pt-BR", FS: files, Patterns: []string{"pt-BR/*.html"}, Fallback: []string{"en"}},
+			},
+		},
+		{
+			description: "It should report the missing and the undefined templates",
+			groups: []TemplateGroup{
+				{Name: "en", FS: files, Patterns: []string{"en/*.html"}},
+				{Name: "pt", FS: files, Patterns: []string{"pt/*.html"}},
+				{Name: "pt-BR", FS: files, Patterns: []string{"pt-BR/*.html"}},
+			},
+			expectedErrors: []string{
+				"Handler “/”: The template “poema.html” isn’t defined in the template group “en” nor in its fallbacks",
+				"Handler “/”: The template “rooster” isn’t defined in the template group “pt” nor in its fallbacks",
+				"Handler “/”: The template “rooster.html” isn’t defined in the template group “pt” nor in its fallbacks",
+				"Handler “/”: The template “poem.html” of the template group “pt” calls the undefined template “galo”",
+				"Handler “/”: The template “poema.html” isn’t defined in the template group “pt-BR” nor in its fallbacks",
+				"Handler “/”: The template “rooster” isn’t defined in the template group “pt-BR” nor in its fallbacks",
+				"Handler “/”: The template “rooster.html” isn’t defined in the template group “pt-BR” nor in its fallbacks",
+			},
+		},
+		{
+			description: "It should accept the templates defined by the default group",
+			groups: []TemplateGroup{
+				{Name: "en", FS: files, Patterns: []string{"en/*.html"}},
+				{Name: "pt", FS: files, Patterns: []string{"pt/poema.html"}, Fallback: []string{"en"}},
+			},
+			defaultGroup: "pt",
+		},
+	}
+
+	for i, item := range data {
+		mux := NewMux()
+		mux.GlobalTemplates = NewTemplateGroupSet(nil)
+
+		for _, group := range item.groups {
+			mux.GlobalTemplates.Insert(TemplateGroup{Name: group.Name, FS: files, Files: []string{"global/header.html"}})
+		}
+
+		set := NewTemplateGroupSet(nil)
+		set.DefaultGroup = item.defaultGroup
+
+		for _, group := range item.groups {
+			set.Insert(group)
+		}
+
+		mux.Register("/", func() Handler { return &templatesHandler{templates: set} })
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		err := mux.Validate()
+
+		if len(item.expectedErrors) == 0 {
+			if err != nil {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			}
+
+			continue
+		}
+
+		errs, ok := err.(TemplateErrors)
+
+		if !ok {
+			t.Errorf("Item %d, “%s”, unexpected error: “%v”", i, item.description, err)
+			continue
+		}
+
+		if len(errs) != len(item.expectedErrors) {
+			t.Errorf("Item %d, “%s”, wrong number of errors. Expecting %d; found %d:\n%s", i, item.description, len(item.expectedErrors), len(errs), errs)
+			continue
+		}
+
+		for k, err := range errs {
+			if err.Error() != item.expectedErrors[k] {
+				t.Errorf("Item %d, “%s”, wrong error. Expecting “%s”; found “%s”", i, item.description, item.expectedErrors[k], err)
+			}
+		}
+	}
+}
+
+type templatesHandler struct {
+	NopHandler
+	templates TemplateGroupSet
+}
+
+func (h *templatesHandler) Templates() TemplateGroupSet {
+	return h.templates
+}
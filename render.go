@@ -0,0 +1,205 @@
+package trama
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressMinLength is the length under which a body isn’t worth compressing.
+const compressMinLength = 1024
+
+// bufferPool holds the buffers the responses are rendered into.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// render executes the template, or encodes the data, set to be written into a
+// buffer, so that an error is found before anything is sent to the client.
+func (r *response) render() error {
+	if r.rendered != nil || !r.written || r.redirect || r.raw || r.streamed != nil {
+		return nil
+	}
+
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	var err error
+
+	if r.encoder != nil {
+		err = r.encoder.Encode(buffer, r.data)
+	} else {
+		var group *TemplateGroup
+		group, err = r.templates.lookup(r.currentTemplateGroup, r.templateName)
+
+		if err == nil {
+			err = r.templates.checkData(r.templateName, r.data)
+		}
+
+		if err == nil {
+			err = group.executeTemplate(buffer, r.Layout(), r.templateName, r.data, r.funcs)
+		}
+
+		if err == nil && r.responseWriter.Header().Get("Content-Type") == "" {
+			r.responseWriter.Header().Set("Content-Type", group.engine().ContentType())
+		}
+	}
+
+	if err != nil {
+		bufferPool.Put(buffer)
+		return err
+	}
+
+	r.rendered = buffer
+	return nil
+}
+
+// release returns the rendered body to the pool.
+func (r *response) release() {
+	if r.rendered != nil {
+		bufferPool.Put(r.rendered)
+		r.rendered = nil
+	}
+}
+
+// writeBody sends the body with its length. A body for a successful GET or
+// HEAD request gets an ETag, so that a request with a matching If-None-Match
+// header is answered with a 304 (Not Modified), and it is compressed if the
+// Mux’s Compress field is set and the client accepts it.
+func (r *response) writeBody(body []byte) {
+	header := r.responseWriter.Header()
+	status := r.Status()
+
+	// The content type can’t be detected by http.ResponseWriter once the body
+	// is compressed.
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+
+	cacheable := status == http.StatusOK && r.request != nil &&
+		(r.request.Method == "GET" || r.request.Method == "HEAD")
+
+	etag := header.Get("ETag")
+
+	if cacheable && etag == "" {
+		hash := fnv.New64a()
+		hash.Write(body)
+		etag = fmt.Sprintf(`"%x"`, hash.Sum64())
+	}
+
+	if r.compress && len(body) >= compressMinLength && header.Get("Content-Encoding") == "" &&
+		compressible(header.Get("Content-Type")) {
+
+		addVary(header, "Accept-Encoding")
+
+		if r.request != nil && acceptsGzip(r.request.Header.Get("Accept-Encoding")) {
+			compressed := bufferPool.Get().(*bytes.Buffer)
+			compressed.Reset()
+			defer bufferPool.Put(compressed)
+
+			writer := gzip.NewWriter(compressed)
+			writer.Write(body)
+			writer.Close()
+
+			body = compressed.Bytes()
+			header.Set("Content-Encoding", "gzip")
+
+			if cacheable && header.Get("ETag") == "" {
+				etag = strings.TrimSuffix(etag, `"`) + `-gzip"`
+			}
+		}
+	}
+
+	if cacheable {
+		header.Set("ETag", etag)
+
+		if matchETag(r.request.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			header.Del("Content-Encoding")
+			r.responseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	r.responseWriter.WriteHeader(status)
+	r.responseWriter.Write(body)
+}
+
+// compressible checks whether the media type is textual, and so worth being
+// compressed.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+
+	return false
+}
+
+// acceptsGzip checks whether the Accept-Encoding header accepts the gzip
+// coding, explicitly or through the wildcard.
+func acceptsGzip(acceptEncoding string) bool {
+	accepted := false
+
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		quality := 1.0
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		switch coding {
+		case "gzip", "x-gzip":
+			return quality > 0
+		case "*":
+			accepted = quality > 0
+		}
+	}
+
+	return accepted
+}
+
+// matchETag checks whether the If-None-Match header matches the entity tag,
+// with the weak comparison of RFC 7232.
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
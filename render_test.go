@@ -0,0 +1,271 @@
+package trama
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	poem := strings.Repeat("Um galo sozinho não tece uma manhã. ", 40)
+
+	files := fstest.MapFS{
+		"poema.html": &fstest.MapFile{Data: []byte(`{{.}}`)},
+		"broken.html": &fstest.MapFile{
+			Data: []byte(`Tecendo a manhã: {{index . 5}}`),
+		},
+		"error.html": &fstest.MapFile{Data: []byte(`Error {{.Status}}`)},
+	}
+
+	data := []struct {
+		description            string
+		method                 string
+		template               string
+		data                   interface{}
+		status                 int
+		compress               bool
+		header                 http.Header
+		responseHeader         http.Header
+		expectedStatus         int
+		expectedBody           string
+		expectedHeader         http.Header
+		expectedMissingHeaders []string
+		expectedCompressedBody bool
+	}{
+		{
+			description:    "It should write a template error as an error page",
+			method:         "GET",
+			template:       "broken.html",
+			data:           []string{"galo"},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Error 500",
+		},
+		{
+			description: "It should remove the entity headers of the page replaced by an error",
+			method:      "GET",
+			template:    "broken.html",
+			data:        []string{"galo"},
+			responseHeader: http.Header{
+				"Content-Type":        {"text/csv"},
+				"Content-Disposition": {`attachment; filename="manha.csv"`},
+				"Etag":                {`"galo"`},
+			},
+			expectedStatus:         http.StatusInternalServerError,
+			expectedBody:           "Error 500",
+			expectedHeader:         http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			expectedMissingHeaders: []string{"Content-Disposition", "Etag"},
+		},
+		{
+			description:    "It should set the length and the entity tag of the page",
+			method:         "GET",
+			template:       "poema.html",
+			data:           "Tecendo a manhã",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Tecendo a manhã",
+			expectedHeader: http.Header{
+				"Content-Length": {strconv.Itoa(len("Tecendo a manhã"))},
+				"Content-Type":   {"text/html; charset=utf-8"},
+				"Etag":           {`"3faac520ddaf5944"`},
+			},
+		},
+		{
+			description:    "It should answer a matching If-None-Match with 304",
+			method:         "GET",
+			template:       "poema.html",
+			data:           "Tecendo a manhã",
+			header:         http.Header{"If-None-Match": {`"galo", W/"3faac520ddaf5944"`}},
+			expectedStatus: http.StatusNotModified,
+			expectedBody:   "",
+			expectedHeader: http.Header{"Etag": {`"3faac520ddaf5944"`}},
+		},
+		{
+			description:            "It shouldn't set an entity tag for other status codes",
+			method:                 "GET",
+			template:               "poema.html",
+			data:                   "Tecendo a manhã",
+			status:                 http.StatusCreated,
+			header:                 http.Header{"If-None-Match": {"*"}},
+			expectedStatus:         http.StatusCreated,
+			expectedBody:           "Tecendo a manhã",
+			expectedMissingHeaders: []string{"Etag"},
+		},
+		{
+			description:            "It shouldn't set an entity tag for other methods",
+			method:                 "POST",
+			template:               "poema.html",
+			data:                   "Tecendo a manhã",
+			expectedStatus:         http.StatusOK,
+			expectedBody:           "Tecendo a manhã",
+			expectedMissingHeaders: []string{"Etag"},
+		},
+		{
+			description:    "It should set the length for a HEAD request",
+			method:         "HEAD",
+			template:       "poema.html",
+			data:           "Tecendo a manhã",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+			expectedHeader: http.Header{"Content-Length": {strconv.Itoa(len("Tecendo a manhã"))}},
+		},
+		{
+			description:    "It should compress the body for a client accepting it",
+			method:         "GET",
+			template:       "poema.html",
+			data:           poem,
+			compress:       true,
+			header:         http.Header{"Accept-Encoding": {"deflate, gzip;q=0.5"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   poem,
+			expectedHeader: http.Header{
+				"Content-Encoding": {"gzip"},
+				"Vary":             {"Accept-Encoding"},
+			},
+			expectedCompressedBody: true,
+		},
+		{
+			description:            "It shouldn't compress the body for a client refusing it",
+			method:                 "GET",
+			template:               "poema.html",
+			data:                   poem,
+			compress:               true,
+			header:                 http.Header{"Accept-Encoding": {"*, gzip;q=0"}},
+			expectedStatus:         http.StatusOK,
+			expectedBody:           poem,
+			expectedHeader:         http.Header{"Vary": {"Accept-Encoding"}},
+			expectedMissingHeaders: []string{"Content-Encoding"},
+		},
+		{
+			description:            "It shouldn't compress a short body",
+			method:                 "GET",
+			template:               "poema.html",
+			data:                   "Tecendo a manhã",
+			compress:               true,
+			header:                 http.Header{"Accept-Encoding": {"gzip"}},
+			expectedStatus:         http.StatusOK,
+			expectedBody:           "Tecendo a manhã",
+			expectedMissingHeaders: []string{"Content-Encoding", "Vary"},
+		},
+		{
+			description:            "It shouldn't compress without being enabled",
+			method:                 "GET",
+			template:               "poema.html",
+			data:                   poem,
+			header:                 http.Header{"Accept-Encoding": {"gzip"}},
+			expectedStatus:         http.StatusOK,
+			expectedBody:           poem,
+			expectedMissingHeaders: []string{"Content-Encoding", "Vary"},
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+		set.Insert(TemplateGroup{FS: files, Patterns: []string{"*.html"}})
+
+		handler := &renderHandler{
+			templates: set,
+			template:  item.template,
+			data:      item.data,
+			status:    item.status,
+			header:    item.responseHeader,
+		}
+
+		mux := NewMux()
+		mux.Compress = item.compress
+		mux.ErrorRenderer = TemplateErrorRenderer{Default: "error.html"}
+		mux.SetLogger(func(err error) {})
+		mux.Register("/", func() Handler { return handler })
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := http.NewRequest(item.method, "/", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for key, values := range item.header {
+			r.Header[key] = values
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		body := w.Body.Bytes()
+
+		if item.expectedCompressedBody {
+			if length := w.Header().Get("Content-Length"); length != strconv.Itoa(len(body)) {
+				t.Errorf("Item %d, “%s”, wrong length. Expecting %d; found %s", i, item.description, len(body), length)
+			}
+
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+
+			if err != nil {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+				continue
+			}
+
+			if body, err = ioutil.ReadAll(reader); err != nil {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+				continue
+			}
+		}
+
+		if string(body) != item.expectedBody {
+			t.Errorf("Item %d, “%s”, wrong body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, body)
+		}
+
+		for key, values := range item.expectedHeader {
+			if value := strings.Join(w.Header()[key], ", "); value != strings.Join(values, ", ") {
+				t.Errorf("Item %d, “%s”, wrong %s header. Expecting “%s”; found “%s”", i, item.description, key, strings.Join(values, ", "), value)
+			}
+		}
+
+		for _, key := range item.expectedMissingHeaders {
+			if value := w.Header().Get(key); value != "" {
+				t.Errorf("Item %d, “%s”, unexpected %s header “%s”", i, item.description, key, value)
+			}
+		}
+	}
+}
+
+type renderHandler struct {
+	NopHandler
+	templates TemplateGroupSet
+	template  string
+	data      interface{}
+	status    int
+	header    http.Header
+}
+
+func (h *renderHandler) Templates() TemplateGroupSet {
+	return h.templates
+}
+
+func (h *renderHandler) Get(res Response, r *http.Request) error {
+	return h.Post(res, r)
+}
+
+func (h *renderHandler) Post(res Response, r *http.Request) error {
+	for key, values := range h.header {
+		res.Header()[key] = values
+	}
+
+	if h.status != 0 {
+		res.SetStatus(h.status)
+	}
+
+	res.ExecuteTemplate(h.template, h.data)
+	return nil
+}
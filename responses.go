@@ -1,9 +1,14 @@
 package trama
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"io"
 	"net/http"
 	"path"
+	"sort"
 )
 
 // Response is the interface to write HTTP responses.
@@ -11,65 +16,349 @@ type Response interface {
 	// SetTemplateGroup specifies which group of templates, among those from
 	// the registered group set (see Handler’s method Template) will be used
 	// when ExecuteTemplate is called. Useful for set system language for
-	// example.
+	// example. If the template is not found in the group, it is looked for in
+	// the group’s fallbacks and in the set’s default group.
 	SetTemplateGroup(name string)
 
+	// TemplateGroups returns the sorted names of the groups in the registered
+	// group set (see Handler’s method Template).
+	TemplateGroups() []string
+
+	// SetLayout overrides the layout, among the templates of the group set,
+	// the template set by ExecuteTemplate will be rendered inside (see
+	// TemplateGroupSet’s Layout field). An empty name renders the template
+	// without any layout.
+	SetLayout(name string)
+
+	// Layout returns the name of the layout the template set by
+	// ExecuteTemplate will be rendered inside, or an empty string if none.
+	Layout() string
+
+	// SetTemplateFuncs binds functions to the templates executed by
+	// ExecuteTemplate in this request, replacing the ones with the same
+	// names. It lets interceptors provide functions depending on the
+	// request, like the URL of the current page or the signed-in user. As
+	// the templates are checked when parsed, each function must also be
+	// declared in the FuncMap of the group set or of the group, possibly
+	// with a placeholder implementation. The functions are bound to copies
+	// of the templates the page reaches, made once and reused by later
+	// requests.
+	SetTemplateFuncs(funcs template.FuncMap)
+
 	// SetHeader sets the HTTP header that will be sent with the response. All
 	// current values of the HTTP header key are going to be replaced.
 	SetHeader(key string, value ...string)
 
+	// Header returns the HTTP header map that will be sent with the response.
+	Header() http.Header
+
 	// SetCookie sets the cookies that will be sent with the response.
 	SetCookie(cookie *http.Cookie)
 
 	// Redirect redirects the request to the specified URL.
 	Redirect(url string, statusCode int)
 
+	// Fail replaces the response with the error, which is written by the
+	// Mux’s ErrorRenderer after the interceptors, as an error returned by the
+	// handler would be. It is meant to be used by an interceptor that can
+	// only find an error in its After method, as when a transaction fails to
+	// commit. A streamed response can’t be replaced, but the error is still
+	// logged.
+	Fail(err error)
+
+	// SetStatus sets the status code the response will be written with,
+	// whichever way it is written. Like the response itself, the status code
+	// is only sent after all the interceptors be executed, so it can still be
+	// overridden by them.
+	SetStatus(code int)
+
+	// Status returns the status code the response will be written with: the
+	// one set by SetStatus, Redirect, WriteJSON or Encode, if any; 200 if
+	// something was set to be written; or 500 otherwise.
+	Status() int
+
 	// ExecuteTemplate looks for the named template among those registered in
 	// the template group specified with SetTemplateGroup, and prepares it to
 	// be parsed using the input data and to be written to the response. The
 	// actual writing will only happen after all the interceptors be executed.
 	ExecuteTemplate(name string, data interface{})
 
+	// WriteJSON prepares the data to be encoded as JSON and written to the
+	// response with the given status code. As with ExecuteTemplate, the
+	// actual writing will only happen after all the interceptors be executed.
+	WriteJSON(status int, data interface{})
+
+	// Encode prepares the data to be serialised by the encoder and written to
+	// the response with the given status code. As with ExecuteTemplate, the
+	// actual writing will only happen after all the interceptors be executed.
+	Encode(status int, encoder Encoder, data interface{})
+
+	// Write appends the bytes to the raw body of the response, which is
+	// written as is, along with the headers set with SetHeader. As with
+	// ExecuteTemplate, the actual writing will only happen after all the
+	// interceptors be executed. Write always returns len(b) and a nil error,
+	// so that the Response can be used as an io.Writer.
+	Write(b []byte) (int, error)
+
+	// Payload returns the data set by a previous call to ExecuteTemplate,
+	// WriteJSON or Encode, or the bytes given to Write. Along with
+	// TemplateName, it is meant to be used by an interceptor that would want
+	// to introspect in its After method the response set by the handler;
+	// calling any of these methods again replaces what the handler has set.
+	Payload() interface{}
+
+	// Stream switches the response to the streaming mode: the status code and
+	// the headers are sent at once and the body is copied from the reader to
+	// the client, which is flushed after each chunk if the underlying
+	// http.ResponseWriter is an http.Flusher. As the response is already
+	// committed when Stream returns, any later attempt to change it is
+	// ignored; interceptors can check what was sent with Streamed.
+	Stream(contentType string, body io.Reader) error
+
+	// Streamed returns the record of what was sent by a previous call to
+	// Stream, or nil if the response is not in the streaming mode.
+	Streamed() *StreamInfo
+
 	// TemplateName returns the name of the template set by a previous call to
 	// ExecuteTemplate. It is meant to be used by an interceptor that would
 	// wanto to instrospect in its After method the response set by the
 	// handler.
 	TemplateName() string
+
+	// WithContext replaces the context of the request with ctx. The request
+	// with the new context is the one passed to the subsequent interceptors’
+	// Before methods, to the handler and to every After method, so it can be
+	// used by an interceptor to provide values to the handler through the
+	// context.
+	WithContext(ctx context.Context)
+
+	// Param returns the value captured by the named segment or wildcard of the
+	// URI pattern the request was routed by (see Mux’s Register method), or
+	// an empty string if there is none.
+	Param(name string) string
+}
+
+// StreamInfo records what was sent to the client in the streaming mode. See
+// Response’s Stream method.
+type StreamInfo struct {
+	// Status is the status code sent to the client.
+	Status int
+
+	// ContentType is the value of the Content-Type header sent to the client.
+	ContentType string
+
+	// Written is the number of bytes of the body sent to the client.
+	Written int64
+
+	// Err is the error that interrupted the copy of the body, if any.
+	Err error
 }
 
 type response struct {
+	redirect             bool
 	redirectURL          string
-	redirectStatusCode   int
 	templateName         string
-	templateData         interface{}
+	data                 interface{}
+	encoder              Encoder
+	raw                  bool
+	body                 bytes.Buffer
+	streamed             *StreamInfo
+	status               int
 	currentTemplateGroup string
+	layout               string
+	layoutSet            bool
+	funcs                template.FuncMap
+	rendered             *bytes.Buffer
+	compress             bool
 	templates            TemplateGroupSet
 	written              bool
 	responseWriter       http.ResponseWriter
 	request              *http.Request
 	log                  func(error)
-	returnStatus         int
+	failure              error
 }
 
 func (r *response) TemplateName() string {
 	return r.templateName
 }
 
+func (r *response) WithContext(ctx context.Context) {
+	r.request = r.request.WithContext(ctx)
+}
+
+func (r *response) Param(name string) string {
+	return PathParam(r.request, name)
+}
+
 func (r *response) SetTemplateGroup(name string) {
 	r.currentTemplateGroup = name
 }
 
+func (r *response) Payload() interface{} {
+	if r.raw {
+		return r.body.Bytes()
+	}
+
+	return r.data
+}
+
+func (r *response) TemplateGroups() []string {
+	names := make([]string, 0, len(r.templates.elements))
+
+	for name := range r.templates.elements {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (r *response) SetLayout(name string) {
+	r.layout = name
+	r.layoutSet = true
+}
+
+func (r *response) Layout() string {
+	if r.layoutSet {
+		return r.layout
+	}
+
+	return r.templates.Layout
+}
+
+func (r *response) SetTemplateFuncs(funcs template.FuncMap) {
+	if r.funcs == nil {
+		r.funcs = make(template.FuncMap, len(funcs))
+	}
+
+	for name, f := range funcs {
+		r.funcs[name] = f
+	}
+}
+
 func (r *response) Redirect(url string, statusCode int) {
+	r.reset()
 	r.written = true
+	r.redirect = true
 	r.redirectURL = url
-	r.redirectStatusCode = statusCode
+	r.status = statusCode
+}
+
+func (r *response) SetStatus(code int) {
+	r.status = code
+}
+
+func (r *response) Status() int {
+	if r.streamed != nil {
+		return r.streamed.Status
+	}
+
+	if r.status != 0 {
+		return r.status
+	}
+
+	if r.written {
+		return http.StatusOK
+	}
+
+	return http.StatusInternalServerError
 }
 
 func (r *response) ExecuteTemplate(name string, data interface{}) {
+	r.reset()
 	r.written = true
 	_, filename := path.Split(name)
 	r.templateName = filename
-	r.templateData = data
+	r.data = data
+}
+
+func (r *response) WriteJSON(status int, data interface{}) {
+	r.Encode(status, JSONEncoder, data)
+}
+
+func (r *response) Encode(status int, encoder Encoder, data interface{}) {
+	r.reset()
+	r.written = true
+	r.status = status
+	r.encoder = encoder
+	r.data = data
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	if !r.raw {
+		r.reset()
+		r.written = true
+		r.raw = true
+	}
+
+	return r.body.Write(b)
+}
+
+func (r *response) Stream(contentType string, body io.Reader) error {
+	if r.streamed != nil {
+		return errors.New("The response was already streamed")
+	}
+
+	r.reset()
+	r.written = true
+
+	if contentType != "" {
+		r.responseWriter.Header().Set("Content-Type", contentType)
+	}
+
+	r.streamed = &StreamInfo{Status: r.Status(), ContentType: contentType}
+	r.responseWriter.WriteHeader(r.streamed.Status)
+	flusher, _ := r.responseWriter.(http.Flusher)
+	buffer := make([]byte, 32*1024)
+
+	for {
+		n, err := body.Read(buffer)
+
+		if n > 0 {
+			written, writeErr := r.responseWriter.Write(buffer[:n])
+			r.streamed.Written += int64(written)
+
+			if writeErr != nil {
+				r.streamed.Err = writeErr
+				return writeErr
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			r.streamed.Err = err
+			return err
+		}
+	}
+}
+
+func (r *response) Streamed() *StreamInfo {
+	return r.streamed
+}
+
+// reset discards what was previously set to be written, so that the last call
+// to a writing method prevails. The status code is kept, unless it was set by
+// a redirect.
+func (r *response) reset() {
+	if r.redirect {
+		r.status = 0
+	}
+
+	r.redirect = false
+	r.redirectURL = ""
+	r.templateName = ""
+	r.data = nil
+	r.encoder = nil
+	r.raw = false
+	r.body.Reset()
+	r.release()
 }
 
 func (r *response) SetHeader(key string, value ...string) {
@@ -84,35 +373,59 @@ func (r *response) SetHeader(key string, value ...string) {
 	}
 }
 
+func (r *response) Header() http.Header {
+	return r.responseWriter.Header()
+}
+
 func (r *response) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(r.responseWriter, cookie)
 }
 
+// discard forgets everything set to be written, including the status code.
+func (r *response) discard() {
+	if r.streamed == nil {
+		r.reset()
+		r.written = false
+		r.status = 0
+	}
+}
+
+func (r *response) Fail(err error) {
+	r.discard()
+	r.failure = err
+}
+
 func (r *response) write() {
+	if r.streamed != nil {
+		return
+	}
+
 	if !r.written {
-		if r.returnStatus != 0 {
-			r.responseWriter.WriteHeader(r.returnStatus)
-		} else {
-			r.responseWriter.WriteHeader(http.StatusInternalServerError)
-		}
+		r.responseWriter.WriteHeader(r.Status())
 		return
 	}
 
-	if r.redirectStatusCode != 0 {
-		http.Redirect(r.responseWriter, r.request, r.redirectURL, r.redirectStatusCode)
-	} else {
-		group, found := r.templates.elements[r.currentTemplateGroup]
+	if r.redirect {
+		http.Redirect(r.responseWriter, r.request, r.redirectURL, r.Status())
+		return
+	}
 
-		if !found {
-			r.log(fmt.Errorf("No template group named “%s” was found", r.currentTemplateGroup))
-			r.responseWriter.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	if err := r.render(); err != nil {
+		r.log(err)
+		r.responseWriter.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		err := group.executeTemplate(r.responseWriter, r.templateName, r.templateData)
+	defer r.release()
 
-		if err != nil {
-			r.log(err)
-		}
+	if r.raw {
+		r.writeBody(r.body.Bytes())
+		return
 	}
+
+	if r.encoder != nil {
+		r.responseWriter.Header().Set("Content-Type", r.encoder.ContentType())
+	}
+
+	r.writeBody(r.rendered.Bytes())
 }
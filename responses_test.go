@@ -0,0 +1,168 @@
+package trama
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	data := []struct {
+		description         string
+		get                 func(Response) error
+		interceptors        InterceptorChain
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			description: "It should write the raw body",
+			get: func(res Response) error {
+				res.SetHeader("Content-Type", "text/csv")
+				fmt.Fprintln(res, "poeta,poema")
+				fmt.Fprintln(res, "João Cabral,Tecendo a manhã")
+				return nil
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody:        "poeta,poema\nJoão Cabral,Tecendo a manhã\n",
+		},
+		{
+			description: "It should write the raw body with the given status",
+			get: func(res Response) error {
+				res.SetStatus(http.StatusCreated)
+				res.Write([]byte("criado"))
+				return nil
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "criado",
+		},
+		{
+			description: "It should let an interceptor inspect the raw body",
+			get: func(res Response) error {
+				res.Write([]byte("um galo sozinho"))
+				return nil
+			},
+			interceptors:        InterceptorChain{&bodyTypeInterceptor{}},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/x-galo",
+			expectedBody:        "um galo sozinho",
+		},
+		{
+			description: "It should discard the raw body when something else is written",
+			get: func(res Response) error {
+				res.Write([]byte("um galo sozinho"))
+				res.Redirect("/manha", http.StatusSeeOther)
+				return nil
+			},
+			expectedStatus: http.StatusSeeOther,
+			expectedBody:   "<a href=\"/manha\">See Other</a>.\n\n",
+		},
+	}
+
+	for i, item := range data {
+		handler := adapter{
+			handler: func() Handler {
+				return &statusHandler{get: item.get, interceptors: item.interceptors}
+			},
+			log: func(err error) {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			},
+		}
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/uri", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if item.expectedContentType != "" && w.Header().Get("Content-Type") != item.expectedContentType {
+			t.Errorf("Item %d, “%s”, wrong content type. Expecting “%s”; found “%s”", i, item.description, item.expectedContentType, w.Header().Get("Content-Type"))
+		}
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	content := strings.Repeat("E se encorpando em tela, entre todos, ", 2000)
+	recorder := &streamRecorder{}
+
+	handler := adapter{
+		handler: func() Handler {
+			return &statusHandler{
+				get: func(res Response) error {
+					res.SetStatus(http.StatusPartialContent)
+					return res.Stream("text/plain", strings.NewReader(content))
+				},
+				interceptors: InterceptorChain{recorder},
+			}
+		},
+		log: func(err error) { t.Error("Unexpected error:", err) },
+	}
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/uri", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("Wrong status code. Expecting %d; found %d", http.StatusPartialContent, w.Code)
+	}
+
+	if w.Body.String() != content {
+		t.Errorf("Unexpected body with %d bytes", w.Body.Len())
+	}
+
+	if !w.Flushed {
+		t.Error("The response was not flushed")
+	}
+
+	if recorder.info == nil {
+		t.Fatal("No stream record found in After")
+	}
+
+	expected := StreamInfo{Status: http.StatusPartialContent, ContentType: "text/plain", Written: int64(len(content))}
+
+	if *recorder.info != expected {
+		t.Errorf("Unexpected stream record. Expecting %+v; found %+v", expected, *recorder.info)
+	}
+}
+
+type bodyTypeInterceptor struct {
+	NopInterceptor
+}
+
+func (i *bodyTypeInterceptor) After(res Response, req *http.Request, err error) {
+	if body, ok := res.Payload().([]byte); ok && strings.Contains(string(body), "galo") {
+		res.SetHeader("Content-Type", "text/x-galo")
+	}
+}
+
+type streamRecorder struct {
+	NopInterceptor
+	info *StreamInfo
+}
+
+func (s *streamRecorder) After(res Response, req *http.Request, err error) {
+	s.info = res.Streamed()
+
+	// The response is committed: this must be ignored.
+	res.SetStatus(http.StatusTeapot)
+	res.Write([]byte("ignorado"))
+}
@@ -0,0 +1,327 @@
+package trama
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// router is a tree of URI patterns. Each level of the tree corresponds to a
+// segment of the path and can hold static children, named parameters
+// (optionally constrained by a regular expression) and a wildcard matching the
+// rest of the path.
+//
+// When more than one pattern matches a request, the precedence is decided
+// segment by segment, from left to right: a static segment is preferred over a
+// constrained parameter, which is preferred over an unconstrained parameter,
+// which is preferred over a wildcard. Constrained parameters are tried in the
+// order they were registered.
+type router struct {
+	root     node
+	patterns map[string]string
+}
+
+type node struct {
+	static   map[string]*node
+	params   []*paramNode
+	wildcard *wildcardNode
+	handler  http.Handler
+}
+
+type paramNode struct {
+	node
+	name       string
+	expr       string
+	constraint *regexp.Regexp
+}
+
+type wildcardNode struct {
+	name    string
+	handler http.Handler
+}
+
+type param struct {
+	name, value string
+}
+
+type paramsKey struct{}
+
+// PathParams returns the values captured by the named segments and wildcards
+// of the pattern used to route the request, indexed by their names.
+func PathParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params
+}
+
+// PathParam returns the value captured by the named segment or wildcard of the
+// pattern used to route the request, or an empty string if there is none.
+func PathParam(r *http.Request, name string) string {
+	return PathParams(r)[name]
+}
+
+func newRouter() *router {
+	return &router{patterns: make(map[string]string)}
+}
+
+// handle registers the handler at the pattern, panicking if the pattern is
+// invalid or if another pattern matching exactly the same paths was already
+// registered, as http.ServeMux does. Unlike in http.ServeMux, patterns can’t
+// be qualified by a host name.
+func (t *router) handle(pattern string, h http.Handler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("trama: pattern “%s” must begin with a slash (host names are not supported)", pattern))
+	}
+
+	segments := strings.Split(pattern[1:], "/")
+	keys := make([]string, len(segments))
+	current := &t.root
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		if last && segment == "" {
+			// A trailing slash matches the whole subtree, like in
+			// http.ServeMux.
+			keys[i] = "{...}"
+			t.register(pattern, keys)
+			current.wildcard = &wildcardNode{handler: h}
+			return
+		}
+
+		if !strings.HasPrefix(segment, "{") {
+			keys[i] = segment
+
+			if current.static == nil {
+				current.static = make(map[string]*node)
+			}
+
+			child, found := current.static[segment]
+
+			if !found {
+				child = &node{}
+				current.static[segment] = child
+			}
+
+			current = child
+			continue
+		}
+
+		if !strings.HasSuffix(segment, "}") {
+			panic(fmt.Sprintf("trama: unclosed brace in pattern “%s”", pattern))
+		}
+
+		name := segment[1 : len(segment)-1]
+
+		if strings.HasSuffix(name, "...") {
+			if !last {
+				panic(fmt.Sprintf("trama: wildcard must be the last segment of pattern “%s”", pattern))
+			}
+
+			keys[i] = "{...}"
+			t.register(pattern, keys)
+			current.wildcard = &wildcardNode{name: strings.TrimSuffix(name, "..."), handler: h}
+			return
+		}
+
+		expr := ""
+
+		if j := strings.Index(name, ":"); j >= 0 {
+			name, expr = name[:j], name[j+1:]
+		}
+
+		if name == "" {
+			panic(fmt.Sprintf("trama: unnamed parameter in pattern “%s”", pattern))
+		}
+
+		keys[i] = "{" + expr + "}"
+		current = current.param(name, expr, pattern)
+	}
+
+	t.register(pattern, keys)
+	current.handler = h
+}
+
+func (t *router) register(pattern string, keys []string) {
+	key := strings.Join(keys, "/")
+
+	if other, found := t.patterns[key]; found {
+		panic(fmt.Sprintf("trama: pattern “%s” conflicts with “%s”", pattern, other))
+	}
+
+	t.patterns[key] = pattern
+}
+
+// param finds or creates the child for the named parameter. Constrained
+// parameters are kept before the unconstrained ones, in registration order.
+func (n *node) param(name, expr, pattern string) *node {
+	for _, p := range n.params {
+		if p.name == name && p.expr == expr {
+			return &p.node
+		}
+	}
+
+	child := &paramNode{name: name, expr: expr}
+
+	if expr == "" {
+		n.params = append(n.params, child)
+		return &child.node
+	}
+
+	constraint, err := regexp.Compile("^(?:" + expr + ")$")
+
+	if err != nil {
+		panic(fmt.Sprintf("trama: invalid constraint in pattern “%s”: %s", pattern, err))
+	}
+
+	child.constraint = constraint
+	k := 0
+
+	for k < len(n.params) && n.params[k].constraint != nil {
+		k++
+	}
+
+	n.params = append(n.params, nil)
+	copy(n.params[k+1:], n.params[k:])
+	n.params[k] = child
+	return &child.node
+}
+
+// match finds the handler for the escaped path, along with the values of the
+// path parameters. The path is expected to be already cleaned (see
+// cleanPath). As in http.ServeMux, when the path without a trailing slash
+// isn’t matched by a pattern of its own, but the path with the slash is the
+// root of a subtree, no handler is returned and redirect is set, even if the
+// subtree of an ancestor, like “/”, matches the path.
+func (t *router) match(escapedPath string) (h http.Handler, params map[string]string, redirect bool) {
+	escaped := strings.Split(strings.TrimPrefix(escapedPath, "/"), "/")
+	segments := make([]string, len(escaped))
+
+	for i, segment := range escaped {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		} else {
+			segments[i] = segment
+		}
+	}
+
+	var captured []param
+	h, remaining := t.root.match(segments, &captured)
+
+	if (h == nil || remaining > 0) && !strings.HasSuffix(escapedPath, "/") {
+		var ignored []param
+
+		// A subtree rooted at the path with the slash is matched by its
+		// wildcard with only the empty segment after the slash remaining.
+		if subtree, remaining := t.root.match(append(segments, ""), &ignored); subtree != nil && remaining == 1 {
+			return nil, nil, true
+		}
+	}
+
+	if h == nil || len(captured) == 0 {
+		return h, nil, false
+	}
+
+	params = make(map[string]string, len(captured))
+
+	for _, p := range captured {
+		params[p.name] = p.value
+	}
+
+	return h, params, false
+}
+
+// match finds the handler for the segments, returning along with it the
+// number of segments matched by a wildcard, if any.
+func (n *node) match(segments []string, params *[]param) (http.Handler, int) {
+	if len(segments) == 0 {
+		return n.handler, 0
+	}
+
+	segment, rest := segments[0], segments[1:]
+
+	if child, found := n.static[segment]; found {
+		if h, remaining := child.match(rest, params); h != nil {
+			return h, remaining
+		}
+	}
+
+	if segment != "" && !containsDotDot(segment) {
+		for _, p := range n.params {
+			if p.constraint != nil && !p.constraint.MatchString(segment) {
+				continue
+			}
+
+			size := len(*params)
+			*params = append(*params, param{p.name, segment})
+
+			if h, remaining := p.match(rest, params); h != nil {
+				return h, remaining
+			}
+
+			*params = (*params)[:size]
+		}
+	}
+
+	if n.wildcard != nil {
+		value := strings.Join(segments, "/")
+
+		if containsDotDot(value) {
+			return nil, 0
+		}
+
+		if n.wildcard.name != "" {
+			*params = append(*params, param{n.wildcard.name, value})
+		}
+
+		return n.wildcard.handler, len(segments)
+	}
+
+	return nil, 0
+}
+
+// containsDotDot tells whether the path has a “..” element, taking both
+// slashes and backslashes as separators. An escaped slash can hide such an
+// element from the path cleaning, so it is never captured by a parameter or a
+// wildcard, which could then reach a handler serving files.
+func containsDotDot(p string) bool {
+	if !strings.Contains(p, "..") {
+		return false
+	}
+
+	for _, element := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanPath returns the canonical form of the path, with “.” and “..”
+// elements and repeated slashes removed, keeping the trailing slash, as
+// http.ServeMux does.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	if p[0] != '/' {
+		p = "/" + p
+	}
+
+	cleaned := path.Clean(p)
+
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func withPathParams(r *http.Request, params map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+}
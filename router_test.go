@@ -0,0 +1,413 @@
+package trama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterMatch(t *testing.T) {
+	patterns := []string{
+		"/domains",
+		"/domains/{name}",
+		"/domains/{name}/contacts/{id:[0-9]+}",
+		"/domains/{name}/contacts/{handle}",
+		"/domains/registro.br/contacts/{handle}",
+		"/domains/{name}/contacts/new",
+		"/files/{path...}",
+		"/static/",
+		"/{year:[0-9]{4}}/{slug}",
+		"/{page}/{slug}",
+	}
+
+	data := []struct {
+		description      string
+		uri              string
+		expectedPattern  string
+		expectedParams   map[string]string
+		expectedRedirect bool
+	}{
+		{
+			description:     "It should match a static pattern",
+			uri:             "/domains",
+			expectedPattern: "/domains",
+		},
+		{
+			description:     "It should capture a named segment",
+			uri:             "/domains/nic.br",
+			expectedPattern: "/domains/{name}",
+			expectedParams:  map[string]string{"name": "nic.br"},
+		},
+		{
+			description:     "It should prefer a constrained parameter",
+			uri:             "/domains/nic.br/contacts/42",
+			expectedPattern: "/domains/{name}/contacts/{id:[0-9]+}",
+			expectedParams:  map[string]string{"name": "nic.br", "id": "42"},
+		},
+		{
+			description:     "It should fall back to an unconstrained parameter",
+			uri:             "/domains/nic.br/contacts/ABC123",
+			expectedPattern: "/domains/{name}/contacts/{handle}",
+			expectedParams:  map[string]string{"name": "nic.br", "handle": "ABC123"},
+		},
+		{
+			description:     "It should prefer a static segment",
+			uri:             "/domains/nic.br/contacts/new",
+			expectedPattern: "/domains/{name}/contacts/new",
+			expectedParams:  map[string]string{"name": "nic.br"},
+		},
+		{
+			description:     "It should prefer the leftmost static segment",
+			uri:             "/domains/registro.br/contacts/new",
+			expectedPattern: "/domains/registro.br/contacts/{handle}",
+			expectedParams:  map[string]string{"handle": "new"},
+		},
+		{
+			description:     "It should backtrack when a static segment leads nowhere",
+			uri:             "/domains/registro.br",
+			expectedPattern: "/domains/{name}",
+			expectedParams:  map[string]string{"name": "registro.br"},
+		},
+		{
+			description:     "It shouldn't match a trailing slash not in the pattern",
+			uri:             "/domains/registro.br/contacts/42/",
+			expectedPattern: "",
+		},
+		{
+			description:     "It should capture the rest of the path in a wildcard",
+			uri:             "/files/a/b/c.txt",
+			expectedPattern: "/files/{path...}",
+			expectedParams:  map[string]string{"path": "a/b/c.txt"},
+		},
+		{
+			description:     "It should match an empty wildcard",
+			uri:             "/files/",
+			expectedPattern: "/files/{path...}",
+			expectedParams:  map[string]string{"path": ""},
+		},
+		{
+			description:     "It should match a subtree",
+			uri:             "/static/css/main.css",
+			expectedPattern: "/static/",
+		},
+		{
+			description:      "It should redirect to a subtree without its trailing slash",
+			uri:              "/static",
+			expectedPattern:  "",
+			expectedRedirect: true,
+		},
+		{
+			description:     "It should unescape the segments",
+			uri:             "/domains/a%2Fb",
+			expectedPattern: "/domains/{name}",
+			expectedParams:  map[string]string{"name": "a/b"},
+		},
+		{
+			description:     "It should try the constrained parameters at the root",
+			uri:             "/2015/tecendo-a-manha",
+			expectedPattern: "/{year:[0-9]{4}}/{slug}",
+			expectedParams:  map[string]string{"year": "2015", "slug": "tecendo-a-manha"},
+		},
+		{
+			description:     "It should try the unconstrained parameters at the root",
+			uri:             "/poemas/tecendo-a-manha",
+			expectedPattern: "/{page}/{slug}",
+			expectedParams:  map[string]string{"page": "poemas", "slug": "tecendo-a-manha"},
+		},
+		{
+			description:     "It shouldn't match an empty segment with a parameter",
+			uri:             "/domains/",
+			expectedPattern: "",
+		},
+		{
+			description:     "It shouldn't capture a parent directory in a wildcard",
+			uri:             "/files/a/..%2F..%2Fetc/passwd",
+			expectedPattern: "",
+		},
+		{
+			description:     "It shouldn't capture a parent directory in a parameter",
+			uri:             "/poemas/..%2Fetc",
+			expectedPattern: "",
+		},
+		{
+			description:     "It shouldn't match an unknown path",
+			uri:             "/cadê/eu/aqui",
+			expectedPattern: "",
+		},
+	}
+
+	router := newRouter()
+
+	for _, pattern := range patterns {
+		router.handle(pattern, patternHandler(pattern))
+	}
+
+	for i, item := range data {
+		r, err := http.NewRequest("GET", item.uri, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, params, redirect := router.match(r.URL.EscapedPath())
+		pattern := ""
+
+		if h != nil {
+			pattern = string(h.(patternHandler))
+		}
+
+		if pattern != item.expectedPattern {
+			t.Errorf("Item %d, “%s”, wrong pattern. Expecting “%s”; found “%s”", i, item.description, item.expectedPattern, pattern)
+		}
+
+		if len(params) != 0 || len(item.expectedParams) != 0 {
+			if !reflect.DeepEqual(params, item.expectedParams) {
+				t.Errorf("Item %d, “%s”, wrong parameters. Expecting %v; found %v", i, item.description, item.expectedParams, params)
+			}
+		}
+
+		if redirect != item.expectedRedirect {
+			t.Errorf("Item %d, “%s”, wrong redirect. Expecting %t; found %t", i, item.description, item.expectedRedirect, redirect)
+		}
+	}
+}
+
+func TestRouterMatchNestedSubtrees(t *testing.T) {
+	patterns := []string{
+		"/",
+		"/docs/",
+		"/files/{path...}",
+	}
+
+	data := []struct {
+		description      string
+		uri              string
+		expectedPattern  string
+		expectedRedirect bool
+	}{
+		{
+			description:      "It should redirect to a subtree inside the root subtree",
+			uri:              "/docs",
+			expectedPattern:  "",
+			expectedRedirect: true,
+		},
+		{
+			description:      "It should redirect to a wildcard inside the root subtree",
+			uri:              "/files",
+			expectedPattern:  "",
+			expectedRedirect: true,
+		},
+		{
+			description:     "It should match the inner subtree",
+			uri:             "/docs/guide",
+			expectedPattern: "/docs/",
+		},
+		{
+			description:     "It should match the root of the inner subtree",
+			uri:             "/docs/",
+			expectedPattern: "/docs/",
+		},
+		{
+			description:     "It should match the root subtree",
+			uri:             "/about",
+			expectedPattern: "/",
+		},
+		{
+			description:     "It should match the root subtree below an unknown directory",
+			uri:             "/about/team",
+			expectedPattern: "/",
+		},
+	}
+
+	router := newRouter()
+
+	for _, pattern := range patterns {
+		router.handle(pattern, patternHandler(pattern))
+	}
+
+	for i, item := range data {
+		h, _, redirect := router.match(item.uri)
+		pattern := ""
+
+		if h != nil {
+			pattern = string(h.(patternHandler))
+		}
+
+		if pattern != item.expectedPattern {
+			t.Errorf("Item %d, “%s”, wrong pattern. Expecting “%s”; found “%s”", i, item.description, item.expectedPattern, pattern)
+		}
+
+		if redirect != item.expectedRedirect {
+			t.Errorf("Item %d, “%s”, wrong redirect. Expecting %t; found %t", i, item.description, item.expectedRedirect, redirect)
+		}
+	}
+}
+
+func TestRouterHandleInvalid(t *testing.T) {
+	data := []struct {
+		description string
+		patterns    []string
+	}{
+		{
+			description: "It should refuse a pattern without a leading slash",
+			patterns:    []string{"domains"},
+		},
+		{
+			description: "It should refuse an unclosed brace",
+			patterns:    []string{"/domains/{name"},
+		},
+		{
+			description: "It should refuse a wildcard in the middle of the pattern",
+			patterns:    []string{"/files/{path...}/info"},
+		},
+		{
+			description: "It should refuse an invalid constraint",
+			patterns:    []string{"/domains/{id:[0-9}"},
+		},
+		{
+			description: "It should refuse an unnamed parameter",
+			patterns:    []string{"/domains/{:[0-9]+}"},
+		},
+		{
+			description: "It should refuse the same pattern twice",
+			patterns:    []string{"/domains/{name}", "/domains/{name}"},
+		},
+		{
+			description: "It should refuse patterns differing only by parameter names",
+			patterns:    []string{"/domains/{name}", "/domains/{id}"},
+		},
+		{
+			description: "It should refuse a subtree and a wildcard at the same place",
+			patterns:    []string{"/files/", "/files/{path...}"},
+		},
+	}
+
+	for i, item := range data {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Item %d, “%s”: no panic found", i, item.description)
+				}
+			}()
+
+			router := newRouter()
+
+			for _, pattern := range item.patterns {
+				router.handle(pattern, patternHandler(pattern))
+			}
+		}()
+	}
+}
+
+func TestMuxPathParams(t *testing.T) {
+	mux := NewMux()
+	mux.SetLogger(func(err error) { t.Error("Unexpected error:", err) })
+
+	handler := &paramsHandler{}
+	mux.Register("/domains/{name}/contacts/{id:[0-9]+}", func() Handler { return handler })
+
+	r, err := http.NewRequest("GET", "/domains/nic.br/contacts/42", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if handler.name != "nic.br" || handler.id != "42" {
+		t.Errorf("Unexpected parameters. Expecting “nic.br” and “42”; found “%s” and “%s”", handler.name, handler.id)
+	}
+}
+
+func TestMuxCanonicalPath(t *testing.T) {
+	mux := NewMux()
+	mux.SetLogger(func(err error) { t.Error("Unexpected error:", err) })
+	mux.Register("/static/", func() Handler { return &NopHandler{} })
+	mux.Register("/files/{path...}", func() Handler { return &NopHandler{} })
+	mux.Register("/", func() Handler { return &NopHandler{} })
+
+	data := []struct {
+		description      string
+		uri              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			description:      "It should redirect a subtree without its trailing slash",
+			uri:              "/static?v=1",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/static/?v=1",
+		},
+		{
+			description:      "It should redirect a wildcard without its trailing slash",
+			uri:              "/files",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/files/",
+		},
+		{
+			description:      "It should redirect a path with parent directories",
+			uri:              "/static/../admin",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/admin",
+		},
+		{
+			description:      "It should redirect a path with escaped parent directories",
+			uri:              "/files/..%2F..%2Fetc/passwd",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/etc/passwd",
+		},
+		{
+			description:      "It should redirect a path with repeated slashes",
+			uri:              "/static//css",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/static/css",
+		},
+		{
+			description:    "It should serve a canonical path",
+			uri:            "/static/css",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			description:    "It shouldn't redirect a path served by the root subtree",
+			uri:            "/admin",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for i, item := range data {
+		r, err := http.NewRequest("GET", item.uri, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if location := w.Header().Get("Location"); location != item.expectedLocation {
+			t.Errorf("Item %d, “%s”, wrong location. Expecting “%s”; found “%s”", i, item.description, item.expectedLocation, location)
+		}
+	}
+}
+
+type patternHandler string
+
+func (p patternHandler) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+type paramsHandler struct {
+	NopHandler
+	name, id string
+}
+
+func (h *paramsHandler) Get(res Response, req *http.Request) error {
+	h.name = res.Param("name")
+	h.id = PathParam(req, "id")
+	res.Redirect("/", http.StatusFound)
+	return nil
+}
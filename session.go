@@ -0,0 +1,395 @@
+package trama
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// SessionInterceptor keeps a session across the requests of a client, stored
+// by a SessionStore and identified by a cookie. As its configuration is shared
+// by the handlers, it is usually declared once, and For is called by each
+// handler wanting to receive the session:
+//
+//	var sessions = trama.SessionInterceptor{
+//		Store:       trama.NewMemorySessionStore(),
+//		IdleTimeout: 30 * time.Minute,
+//		Lifetime:    12 * time.Hour,
+//		Secure:      true,
+//	}
+//
+//	func (h *handler) Interceptors() trama.InterceptorChain {
+//		return trama.NewInterceptorChain(sessions.For(h))
+//	}
+//
+// The session is also available to the following interceptors and to the
+// handler through CurrentSession. It is only loaded from the store when first
+// used, and only saved, with its cookie sent, when modified, or when a tenth
+// of the idle timeout has passed since it was last saved, so that it is kept
+// alive. A session expired by the idle timeout or by the lifetime is replaced
+// by an empty one. A session the store fails to load is replaced by an empty
+// one as well, with the error reported by Session’s Err method; if the session
+// was loaded before the handler, by a previous interceptor, the handler isn’t
+// called and the error is written instead.
+type SessionInterceptor struct {
+	NopInterceptor
+
+	// Store keeps the sessions.
+	Store SessionStore
+
+	// Cookie is the name of the cookie identifying the session; “session”
+	// if empty.
+	Cookie string
+
+	// IdleTimeout is how long a session lasts without being used. Zero means
+	// no limit.
+	IdleTimeout time.Duration
+
+	// Lifetime is how long a session lasts since it was created, however it
+	// is used. Zero means no limit.
+	Lifetime time.Duration
+
+	// Path and Domain are the scope of the cookie. The path is “/” if empty.
+	Path, Domain string
+
+	// Secure restricts the cookie to HTTPS requests.
+	Secure bool
+
+	// SameSite is the SameSite attribute of the cookie; http.SameSiteLaxMode
+	// if zero.
+	SameSite http.SameSite
+
+	target SessionSetter
+}
+
+// SessionSetter is implemented by the handlers receiving the session of a
+// SessionInterceptor.
+type SessionSetter interface {
+	SetSession(*Session)
+}
+
+type sessionKey struct{}
+
+// For returns a copy of the interceptor giving the session to the target,
+// usually the handler itself.
+func (s SessionInterceptor) For(target SessionSetter) *SessionInterceptor {
+	s.target = target
+	return &s
+}
+
+// Before prepares the session of the request, to be loaded when used.
+func (s *SessionInterceptor) Before(res Response, r *http.Request) error {
+	session := &Session{interceptor: s}
+
+	if cookie, err := r.Cookie(s.cookieName()); err == nil {
+		session.key = cookie.Value
+	}
+
+	res.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+
+	if s.target != nil {
+		s.target.SetSession(session)
+	}
+
+	return nil
+}
+
+// Around keeps the handler from running with an empty session when the store
+// already failed to load it, as when an interceptor used the session before.
+func (s *SessionInterceptor) Around(res Response, r *http.Request, next func() error) error {
+	if session := CurrentSession(r); session != nil && session.loaded && session.err != nil {
+		return session.err
+	}
+
+	return next()
+}
+
+// After saves the session if needed, sending its cookie. An error of the
+// store, either when loading or saving the session, replaces the response
+// with a 500 (Internal Server Error).
+func (s *SessionInterceptor) After(res Response, r *http.Request, err error) {
+	session := CurrentSession(r)
+
+	if session == nil {
+		return
+	}
+
+	if err := session.save(res); err != nil {
+		res.Fail(err)
+	}
+}
+
+func (s *SessionInterceptor) cookieName() string {
+	if s.Cookie == "" {
+		return "session"
+	}
+
+	return s.Cookie
+}
+
+// expired checks whether the session expired, by the time stored with it or by
+// the current timeouts.
+func (s *SessionInterceptor) expired(data *SessionData, now time.Time) bool {
+	return data.ID == "" ||
+		!data.Expires.IsZero() && !now.Before(data.Expires) ||
+		s.IdleTimeout > 0 && now.Sub(data.Accessed) >= s.IdleTimeout ||
+		s.Lifetime > 0 && now.Sub(data.Created) >= s.Lifetime
+}
+
+// CurrentSession returns the session of the request, or nil if the handler
+// has no SessionInterceptor.
+func CurrentSession(r *http.Request) *Session {
+	session, _ := r.Context().Value(sessionKey{}).(*Session)
+	return session
+}
+
+// SessionData is the content of a session, as kept by a SessionStore.
+type SessionData struct {
+	ID       string            `json:"id"`
+	Values   map[string]string `json:"values"`
+	Created  time.Time         `json:"created"`
+	Accessed time.Time         `json:"accessed"`
+
+	// Expires is when the session expires by its idle timeout or lifetime,
+	// the earliest; zero if the session doesn’t expire.
+	Expires time.Time `json:"expires"`
+}
+
+// A SessionStore keeps the sessions, which are identified in the cookie by the
+// key returned when saved.
+type SessionStore interface {
+	// Load returns the session stored under the key, or nil if there is
+	// none.
+	Load(key string) (*SessionData, error)
+
+	// Save stores the session, returning the key to be sent in the cookie.
+	Save(data *SessionData) (string, error)
+
+	// Delete removes the session stored under the key, if any.
+	Delete(key string) error
+}
+
+// Session holds the values of a client across requests. A Session is meant to
+// be used only by the request it belongs to.
+type Session struct {
+	interceptor *SessionInterceptor
+	key         string
+	data        *SessionData
+	loaded      bool
+	modified    bool
+	destroyed   bool
+	oldKey      string
+	err         error
+}
+
+// ID returns the identifier of the session, which is empty while the session
+// is new and unmodified.
+func (s *Session) ID() string {
+	s.load()
+
+	if s.data == nil {
+		return ""
+	}
+
+	return s.data.ID
+}
+
+// Err loads the session, if it wasn’t loaded yet, and returns the error of
+// the store, if any. A session failing to load is empty and the response is
+// replaced by a 500 (Internal Server Error) in the end, but a handler with side
+// effects depending on the client, such as committing a transaction, should
+// check Err before acting on the session’s values.
+func (s *Session) Err() error {
+	s.load()
+	return s.err
+}
+
+// Get returns the value stored under the key, or an empty string if there is
+// none.
+func (s *Session) Get(key string) string {
+	s.load()
+
+	if s.data == nil {
+		return ""
+	}
+
+	return s.data.Values[key]
+}
+
+// Set stores the value under the key.
+func (s *Session) Set(key, value string) {
+	s.modify()
+	s.data.Values[key] = value
+}
+
+// Delete removes the value stored under the key.
+func (s *Session) Delete(key string) {
+	if s.Get(key) != "" {
+		s.modify()
+		delete(s.data.Values, key)
+	}
+}
+
+// RenewID gives the session a new identifier, keeping its values, and a new
+// CSRF token (see CSRFInterceptor). It should be called whenever the
+// privileges of the client change, as on sign in, so that an identifier or a
+// token known before can’t be used to take over the session.
+func (s *Session) RenewID() {
+	s.modify()
+
+	if s.oldKey == "" {
+		s.oldKey = s.key
+	}
+
+	s.data.ID = newSessionID()
+	s.data.Values[CSRFField] = base64.RawURLEncoding.EncodeToString(newCSRFToken())
+}
+
+// Destroy removes the session from the store and expires its cookie, as on
+// sign out. The session can still be used afterwards, starting empty.
+func (s *Session) Destroy() {
+	s.load()
+
+	if s.oldKey == "" {
+		s.oldKey = s.key
+	}
+
+	s.data = nil
+	s.modified = false
+	s.destroyed = true
+}
+
+// load reads the session from the store, the first time it is used. A session
+// not found, expired or failing to load is replaced by an empty one; the
+// failure is reported by SessionInterceptor’s After method.
+func (s *Session) load() {
+	if s.loaded {
+		return
+	}
+
+	s.loaded = true
+
+	if s.key == "" {
+		return
+	}
+
+	data, err := s.interceptor.Store.Load(s.key)
+
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	if data != nil && s.interceptor.expired(data, time.Now()) {
+		s.err = s.interceptor.Store.Delete(s.key)
+		data = nil
+	}
+
+	if data != nil && data.Values == nil {
+		data.Values = make(map[string]string)
+	}
+
+	s.data = data
+}
+
+// modify marks the session to be saved, creating it if needed.
+func (s *Session) modify() {
+	s.load()
+	s.modified = true
+
+	if s.data == nil {
+		now := time.Now()
+		s.data = &SessionData{ID: newSessionID(), Values: make(map[string]string), Created: now, Accessed: now}
+
+		if s.oldKey == "" {
+			s.oldKey = s.key
+		}
+	}
+}
+
+// save writes the session to the store and sends its cookie, if needed.
+func (s *Session) save(res Response) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	interceptor := s.interceptor
+	now := time.Now()
+
+	if !s.modified && s.data != nil && interceptor.IdleTimeout > 0 &&
+		now.Sub(s.data.Accessed) > interceptor.IdleTimeout/10 {
+
+		s.modified = true
+	}
+
+	if s.oldKey != "" && (s.destroyed || s.modified) {
+		if err := interceptor.Store.Delete(s.oldKey); err != nil {
+			return err
+		}
+	}
+
+	cookie := &http.Cookie{
+		Name:     interceptor.cookieName(),
+		Path:     interceptor.Path,
+		Domain:   interceptor.Domain,
+		Secure:   interceptor.Secure,
+		HttpOnly: true,
+		SameSite: interceptor.SameSite,
+	}
+
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+
+	if !s.modified {
+		if s.destroyed && s.key != "" {
+			cookie.MaxAge = -1
+			res.SetCookie(cookie)
+		}
+
+		return nil
+	}
+
+	s.data.Accessed = now
+	s.data.Expires = time.Time{}
+
+	if interceptor.IdleTimeout > 0 {
+		s.data.Expires = now.Add(interceptor.IdleTimeout)
+	}
+
+	if interceptor.Lifetime > 0 {
+		if expires := s.data.Created.Add(interceptor.Lifetime); s.data.Expires.IsZero() || expires.Before(s.data.Expires) {
+			s.data.Expires = expires
+		}
+	}
+
+	key, err := interceptor.Store.Save(s.data)
+
+	if err != nil {
+		return err
+	}
+
+	s.key, s.oldKey, s.modified = key, "", false
+	cookie.Value = key
+	cookie.Expires = s.data.Expires
+	res.SetCookie(cookie)
+	return nil
+}
+
+// newSessionID generates a random session identifier.
+func newSessionID() string {
+	id := make([]byte, 32)
+
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
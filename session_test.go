@@ -0,0 +1,298 @@
+package trama
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sessionID = "6f6c6864617366617a656e64617362726173696c6569726173646f6d756e646f"
+
+func TestSessionInterceptor(t *testing.T) {
+	now := time.Now()
+
+	data := []struct {
+		description    string
+		stored         *SessionData
+		cookie         string
+		action         func(*Session) string
+		expectedBody   string
+		expectedCookie string
+		expectedValue  string
+		expectedLoads  int
+		expectRenewal  bool
+	}{
+		{
+			description:   "It should not load an unused session",
+			cookie:        sessionID,
+			stored:        &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now},
+			action:        func(*Session) string { return "" },
+			expectedValue: "Drummond",
+		},
+		{
+			description:   "It should read the stored session without saving it",
+			cookie:        sessionID,
+			stored:        &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now},
+			action:        func(s *Session) string { return s.Get("poeta") },
+			expectedBody:  "Drummond",
+			expectedValue: "Drummond",
+			expectedLoads: 1,
+		},
+		{
+			description:    "It should not save a new session until it is modified",
+			action:         func(s *Session) string { return s.Get("poeta") },
+			expectedCookie: "",
+		},
+		{
+			description:    "It should save a modified session",
+			action:         func(s *Session) string { s.Set("poeta", "Bandeira"); return "" },
+			expectedCookie: "set",
+			expectedValue:  "Bandeira",
+		},
+		{
+			description:    "It should keep an idle session alive",
+			cookie:         sessionID,
+			stored:         &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now.Add(-5 * time.Minute)},
+			action:         func(s *Session) string { return s.Get("poeta") },
+			expectedBody:   "Drummond",
+			expectedCookie: "set",
+			expectedValue:  "Drummond",
+			expectedLoads:  1,
+		},
+		{
+			description:   "It should replace a session expired by the idle timeout",
+			cookie:        sessionID,
+			stored:        &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now.Add(-time.Hour)},
+			action:        func(s *Session) string { return s.Get("poeta") },
+			expectedLoads: 1,
+		},
+		{
+			description:   "It should replace a session expired by the lifetime",
+			cookie:        sessionID,
+			stored:        &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now.Add(-25 * time.Hour), Accessed: now},
+			action:        func(s *Session) string { return s.Get("poeta") },
+			expectedLoads: 1,
+		},
+		{
+			description:    "It should renew the identifier of the session",
+			cookie:         sessionID,
+			stored:         &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now},
+			action:         func(s *Session) string { s.RenewID(); return s.Get("poeta") },
+			expectedBody:   "Drummond",
+			expectedCookie: "set",
+			expectedValue:  "Drummond",
+			expectedLoads:  1,
+			expectRenewal:  true,
+		},
+		{
+			description:    "It should destroy the session",
+			cookie:         sessionID,
+			stored:         &SessionData{ID: sessionID, Values: map[string]string{"poeta": "Drummond"}, Created: now, Accessed: now},
+			action:         func(s *Session) string { s.Destroy(); return s.Get("poeta") },
+			expectedCookie: "deleted",
+			expectedLoads:  1,
+		},
+	}
+
+	for i, item := range data {
+		store := &countingSessionStore{MemorySessionStore: NewMemorySessionStore()}
+
+		if item.stored != nil {
+			store.MemorySessionStore.Save(item.stored)
+		}
+
+		sessions := SessionInterceptor{Store: store, IdleTimeout: 30 * time.Minute, Lifetime: 24 * time.Hour}
+
+		mux := NewMux()
+		mux.Register("/", func() Handler {
+			return &sessionHandler{interceptor: sessions, action: item.action}
+		})
+
+		r := httptest.NewRequest("GET", "/", nil)
+
+		if item.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: item.cookie})
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if body := w.Body.String(); body != item.expectedBody {
+			t.Errorf("Item %d, “%s”, wrong body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, body)
+		}
+
+		if store.loads != item.expectedLoads {
+			t.Errorf("Item %d, “%s”, wrong number of loads. Expecting %d; found %d", i, item.description, item.expectedLoads, store.loads)
+		}
+
+		var cookie *http.Cookie
+
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "session" {
+				cookie = c
+			}
+		}
+
+		switch {
+		case item.expectedCookie == "" && cookie != nil:
+			t.Errorf("Item %d, “%s”, unexpected cookie “%s”", i, item.description, cookie)
+			continue
+		case item.expectedCookie == "set" && (cookie == nil || cookie.Value == "" || !cookie.HttpOnly):
+			t.Errorf("Item %d, “%s”, the session cookie wasn’t set: “%v”", i, item.description, cookie)
+			continue
+		case item.expectedCookie == "deleted" && (cookie == nil || cookie.MaxAge >= 0):
+			t.Errorf("Item %d, “%s”, the session cookie wasn’t deleted: “%v”", i, item.description, cookie)
+			continue
+		}
+
+		key := item.cookie
+
+		if cookie != nil && cookie.Value != "" {
+			key = cookie.Value
+		}
+
+		if item.expectRenewal && key == item.cookie {
+			t.Errorf("Item %d, “%s”, the session identifier wasn’t renewed", i, item.description)
+		}
+
+		if item.expectRenewal {
+			if old, _ := store.Load(item.cookie); old != nil {
+				t.Errorf("Item %d, “%s”, the old session wasn’t removed", i, item.description)
+			}
+		}
+
+		value := ""
+
+		if stored, _ := store.MemorySessionStore.Load(key); stored != nil {
+			value = stored.Values["poeta"]
+		}
+
+		if value != item.expectedValue {
+			t.Errorf("Item %d, “%s”, wrong stored value. Expecting “%s”; found “%s”", i, item.description, item.expectedValue, value)
+		}
+	}
+}
+
+func TestSessionInterceptorStoreError(t *testing.T) {
+	data := []struct {
+		description    string
+		preload        bool
+		expectedCalled bool
+	}{
+		{
+			description:    "It should report the error to the handler using the session",
+			expectedCalled: true,
+		},
+		{
+			description: "It shouldn't call the handler when the session failed to load before",
+			preload:     true,
+		},
+	}
+
+	for i, item := range data {
+		var errs []error
+		var loadErr error
+		called := false
+
+		mux := NewMux()
+		mux.SetLogger(func(err error) { errs = append(errs, err) })
+		mux.Register("/", func() Handler {
+			return &sessionHandler{
+				interceptor: SessionInterceptor{Store: brokenSessionStore{}},
+				preload:     item.preload,
+				action: func(s *Session) string {
+					called = true
+					loadErr = s.Err()
+					return s.Get("poeta")
+				},
+			}
+		})
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: sessionID})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, http.StatusInternalServerError, w.Code)
+		}
+
+		if called != item.expectedCalled {
+			t.Errorf("Item %d, “%s”, wrong handler call. Expecting %t; found %t", i, item.description, item.expectedCalled, called)
+		}
+
+		if called && (loadErr == nil || !strings.Contains(loadErr.Error(), "Store unavailable")) {
+			t.Errorf("Item %d, “%s”, the error wasn’t reported to the handler: %v", i, item.description, loadErr)
+		}
+
+		if item.expectedCalled && (len(errs) != 1 || !strings.Contains(errs[0].Error(), "Store unavailable")) {
+			t.Errorf("Item %d, “%s”, unexpected errors: %v", i, item.description, errs)
+		}
+	}
+}
+
+type sessionHandler struct {
+	NopHandler
+	interceptor SessionInterceptor
+	session     *Session
+	action      func(*Session) string
+	preload     bool
+}
+
+func (h *sessionHandler) SetSession(session *Session) {
+	h.session = session
+}
+
+func (h *sessionHandler) Interceptors() InterceptorChain {
+	if h.preload {
+		return NewInterceptorChain(h.interceptor.For(h), &sessionReader{})
+	}
+
+	return NewInterceptorChain(h.interceptor.For(h))
+}
+
+// sessionReader uses the session before the handler.
+type sessionReader struct {
+	NopInterceptor
+}
+
+func (s *sessionReader) Before(res Response, r *http.Request) error {
+	CurrentSession(r).Get("poeta")
+	return nil
+}
+
+func (h *sessionHandler) Get(res Response, req *http.Request) error {
+	if CurrentSession(req) != h.session {
+		return errors.New("The session of the context isn’t the one of the handler")
+	}
+
+	res.Write([]byte(h.action(h.session)))
+	return nil
+}
+
+type countingSessionStore struct {
+	*MemorySessionStore
+	loads int
+}
+
+func (c *countingSessionStore) Load(key string) (*SessionData, error) {
+	c.loads++
+	return c.MemorySessionStore.Load(key)
+}
+
+type brokenSessionStore struct{}
+
+func (brokenSessionStore) Load(string) (*SessionData, error) {
+	return nil, errors.New("Store unavailable")
+}
+
+func (brokenSessionStore) Save(*SessionData) (string, error) {
+	return "", errors.New("Store unavailable")
+}
+
+func (brokenSessionStore) Delete(string) error {
+	return errors.New("Store unavailable")
+}
@@ -0,0 +1,277 @@
+package trama
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cookieMaxLength is the length over which a cookie may be refused by the
+// browsers.
+const cookieMaxLength = 4000
+
+// CookieSessionStore keeps the sessions in the cookies themselves, signed with
+// HMAC-SHA256 so that they can’t be forged. The values are readable by the
+// client, so secrets must not be stored in them; and, as the store keeps
+// nothing, a cookie copied before the session was renewed or destroyed is
+// valid until it expires.
+type CookieSessionStore struct {
+	keys [][]byte
+}
+
+// NewCookieSessionStore creates a CookieSessionStore signing the sessions with
+// the first key. Sessions signed with any of the keys are accepted, so that
+// the keys can be rotated.
+func NewCookieSessionStore(key []byte, oldKeys ...[]byte) *CookieSessionStore {
+	return &CookieSessionStore{keys: append([][]byte{key}, oldKeys...)}
+}
+
+// Load verifies the signature of the key and decodes the session in it.
+func (c *CookieSessionStore) Load(key string) (*SessionData, error) {
+	parts := strings.Split(key, ".")
+
+	if len(parts) != 2 {
+		return nil, nil
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, k := range c.keys {
+		if !hmac.Equal(signature, sign(k, parts[0])) {
+			continue
+		}
+
+		content, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+		if err != nil {
+			return nil, nil
+		}
+
+		var data SessionData
+
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, nil
+		}
+
+		return &data, nil
+	}
+
+	return nil, nil
+}
+
+// Save encodes and signs the session.
+func (c *CookieSessionStore) Save(data *SessionData) (string, error) {
+	content, err := json.Marshal(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(content)
+	key := payload + "." + base64.RawURLEncoding.EncodeToString(sign(c.keys[0], payload))
+
+	if len(key) > cookieMaxLength {
+		return "", errors.New("The session is too large to be stored in a cookie")
+	}
+
+	return key, nil
+}
+
+// Delete does nothing, as the sessions are kept by the clients.
+func (c *CookieSessionStore) Delete(key string) error {
+	return nil
+}
+
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// sweepInterval is the interval between the removals of the expired sessions
+// from a MemorySessionStore.
+const sweepInterval = time.Minute
+
+// MemorySessionStore keeps the sessions in memory, keyed by their identifiers.
+// The sessions are lost when the process ends and aren’t shared among
+// processes.
+type MemorySessionStore struct {
+	mutex     sync.Mutex
+	sessions  map[string]SessionData
+	lastSweep time.Time
+}
+
+// NewMemorySessionStore creates an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]SessionData)}
+}
+
+// Load returns a copy of the session with the identifier.
+func (m *MemorySessionStore) Load(key string) (*SessionData, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, found := m.sessions[key]
+
+	if !found {
+		return nil, nil
+	}
+
+	return copySessionData(data), nil
+}
+
+// Save stores a copy of the session, removing the expired ones from time to
+// time.
+func (m *MemorySessionStore) Save(data *SessionData) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for id, session := range m.sessions {
+			if !session.Expires.IsZero() && !now.Before(session.Expires) {
+				delete(m.sessions, id)
+			}
+		}
+
+		m.lastSweep = now
+	}
+
+	m.sessions[data.ID] = *copySessionData(*data)
+	return data.ID, nil
+}
+
+// Delete removes the session with the identifier.
+func (m *MemorySessionStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.sessions, key)
+	return nil
+}
+
+func copySessionData(data SessionData) *SessionData {
+	values := make(map[string]string, len(data.Values))
+
+	for key, value := range data.Values {
+		values[key] = value
+	}
+
+	data.Values = values
+	return &data
+}
+
+// FileSessionStore keeps the sessions as JSON files in a directory, named
+// after their identifiers. The expired sessions are removed when loaded.
+type FileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore creates a FileSessionStore in the directory, which must
+// exist.
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{dir: dir}
+}
+
+// Load reads the session with the identifier.
+func (f *FileSessionStore) Load(key string) (*SessionData, error) {
+	if !validSessionID(key) {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(f.dir, key))
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var data SessionData
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+
+	if !data.Expires.IsZero() && !time.Now().Before(data.Expires) {
+		return nil, f.Delete(key)
+	}
+
+	return &data, nil
+}
+
+// Save writes the session to its file, replacing it atomically.
+func (f *FileSessionStore) Save(data *SessionData) (string, error) {
+	if !validSessionID(data.ID) {
+		return "", errors.New("Invalid session identifier")
+	}
+
+	content, err := json.Marshal(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile(f.dir, ".session-")
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if err := os.Rename(file.Name(), filepath.Join(f.dir, data.ID)); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+// Delete removes the file of the session with the identifier.
+func (f *FileSessionStore) Delete(key string) error {
+	if !validSessionID(key) {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(f.dir, key))
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// validSessionID checks whether the identifier was generated by
+// newSessionID, so that it can’t point outside the directory of a
+// FileSessionStore.
+func validSessionID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 32
+}
@@ -0,0 +1,132 @@
+package trama
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStores(t *testing.T) {
+	data := []struct {
+		description string
+		store       SessionStore
+	}{
+		{
+			description: "It should keep the sessions in cookies",
+			store:       NewCookieSessionStore([]byte("Quadrilha")),
+		},
+		{
+			description: "It should keep the sessions in memory",
+			store:       NewMemorySessionStore(),
+		},
+		{
+			description: "It should keep the sessions in files",
+			store:       NewFileSessionStore(t.TempDir()),
+		},
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	session := &SessionData{
+		ID:       sessionID,
+		Values:   map[string]string{"João": "Teresa", "Raimundo": "Maria"},
+		Created:  now,
+		Accessed: now,
+		Expires:  now.Add(time.Hour),
+	}
+
+	for i, item := range data {
+		key, err := item.store.Save(session)
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		loaded, err := item.store.Load(key)
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(loaded, session) {
+			t.Errorf("Item %d, “%s”, wrong session. Expecting “%+v”; found “%+v”", i, item.description, session, loaded)
+		}
+
+		if loaded, err := item.store.Load("J. Pinto Fernandes"); loaded != nil || err != nil {
+			t.Errorf("Item %d, “%s”, unexpected session for an unknown key: “%+v”, “%v”", i, item.description, loaded, err)
+		}
+
+		if _, isCookie := item.store.(*CookieSessionStore); isCookie {
+			continue
+		}
+
+		if err := item.store.Delete(key); err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		}
+
+		if loaded, err := item.store.Load(key); loaded != nil || err != nil {
+			t.Errorf("Item %d, “%s”, unexpected deleted session: “%+v”, “%v”", i, item.description, loaded, err)
+		}
+	}
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	oldStore := NewCookieSessionStore([]byte("Lili"))
+	store := NewCookieSessionStore([]byte("Quadrilha"), []byte("Lili"))
+	session := &SessionData{ID: sessionID, Values: map[string]string{"Lili": "ninguém"}}
+
+	oldKey, err := oldStore.Save(session)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, _ := store.Load(oldKey); loaded == nil {
+		t.Error("A session signed with an old key should be accepted")
+	}
+
+	key, err := store.Save(session)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, _ := oldStore.Load(key); loaded != nil {
+		t.Error("A session signed with an unknown key should be rejected")
+	}
+
+	forged := "e" + key[1:]
+
+	if key[0] == 'e' {
+		forged = "f" + key[1:]
+	}
+
+	if loaded, _ := store.Load(forged); loaded != nil {
+		t.Error("A tampered session should be rejected")
+	}
+
+	session.Values["J. Pinto Fernandes"] = strings.Repeat("que não tinha entrado na história ", 200)
+
+	if _, err := store.Save(session); err == nil {
+		t.Error("A session too large for a cookie should be rejected")
+	}
+}
+
+func TestFileSessionStoreExpired(t *testing.T) {
+	store := NewFileSessionStore(t.TempDir())
+	session := &SessionData{ID: sessionID, Expires: time.Now().Add(-time.Minute)}
+
+	if _, err := store.Save(session); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, err := store.Load(sessionID); loaded != nil || err != nil {
+		t.Errorf("Unexpected expired session: “%+v”, “%v”", loaded, err)
+	}
+
+	if _, err := store.Save(&SessionData{ID: "../../etc/passwd"}); err == nil {
+		t.Error("An invalid session identifier should be rejected")
+	}
+}
@@ -4,10 +4,19 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
 )
 
 // A TemplateGroup groups templates by a name. It can be used for organise
 // templates by language, for instance, if one needs support for localisation.
+//
+// The templates of a group are named after the base name of their files,
+// whether they are read from the operating system’s file system or from FS.
 type TemplateGroup struct {
 	// Name is the given name of a group. If one is grouping its templates by
 	// language, Name can be “pt” or “en” for example.
@@ -16,40 +25,241 @@ type TemplateGroup struct {
 	// Files is the list of files contained in the group.
 	Files []string
 
-	templ *template.Template
+	// Patterns is a list of glob patterns matching files contained in the
+	// group, in the syntax of filepath.Match, or of path.Match if FS is set.
+	Patterns []string
+
+	// FS is an optional file system, such as an embed.FS, from which Files
+	// and Patterns are read. If it is nil, they are read from the operating
+	// system’s file system.
+	FS fs.FS
+
+	// Fallback is the list of groups where a template is looked for, in
+	// order, when it is not found in this group. For instance, a “pt-BR”
+	// group could fall back to a “pt” group. The fallbacks of the fallback
+	// groups are also followed.
+	Fallback []string
+
+	// Catalog is an optional catalog translating the messages of the group’s
+	// templates through the functions T and N (see Catalog). A group with a
+	// catalog and no files of its own shares the templates of the first of
+	// its fallbacks having files, so that the same template files can be
+	// rendered in many languages.
+	Catalog *Catalog
+
+	// FuncMap is an optional template.FuncMap available only for the
+	// templates of this group, which prevails over the FuncMap of the group
+	// set.
+	FuncMap template.FuncMap
+
+	// Engine is the engine parsing and executing the templates of the group.
+	// If it is nil, HTMLEngine is used.
+	Engine Engine
+
+	// merged holds the groups with the same name merged into this one whose
+	// files are read from a different file system.
+	merged []*TemplateGroup
+	templ  ParsedTemplates
+}
+
+func (t *TemplateGroup) clone() *TemplateGroup {
+	clone := *t
+	clone.Files = append([]string(nil), t.Files...)
+	clone.Patterns = append([]string(nil), t.Patterns...)
+	clone.Fallback = append([]string(nil), t.Fallback...)
+	clone.merged = append([]*TemplateGroup(nil), t.merged...)
+
+	if t.FuncMap != nil {
+		clone.FuncMap = make(template.FuncMap, len(t.FuncMap))
+
+		for name, f := range t.FuncMap {
+			clone.FuncMap[name] = f
+		}
+	}
+
+	return &clone
 }
 
 func (t *TemplateGroup) merge(other *TemplateGroup) {
-	t.Files = append(t.Files, other.Files...)
+	if len(t.Fallback) == 0 {
+		t.Fallback = append([]string(nil), other.Fallback...)
+	}
+
+	if t.Catalog == nil {
+		t.Catalog = other.Catalog
+	}
+
+	if t.Engine == nil {
+		t.Engine = other.Engine
+	}
+
+	if len(other.FuncMap) > 0 && t.FuncMap == nil {
+		t.FuncMap = make(template.FuncMap)
+	}
+
+	for name, f := range other.FuncMap {
+		if _, found := t.FuncMap[name]; !found {
+			t.FuncMap[name] = f
+		}
+	}
+
+	if t.FS == nil && other.FS == nil {
+		t.Files = append(t.Files, other.Files...)
+		t.Patterns = append(t.Patterns, other.Patterns...)
+		t.merged = append(t.merged, other.merged...)
+		return
+	}
+
+	t.merged = append(t.merged, other)
 }
 
-func (t *TemplateGroup) parse(leftDelim, rightDelim string, funcMap template.FuncMap) (err error) {
-	t.templ = template.New(t.Name)
+// resolve lists the files of the group, expanding the patterns. On error, the
+// files found so far are returned along with it.
+func (t *TemplateGroup) resolve() ([]TemplateFile, error) {
+	var files []TemplateFile
 
-	if leftDelim != "" || rightDelim != "" {
-		t.templ = t.templ.Delims(leftDelim, rightDelim)
+	for _, name := range t.Files {
+		files = append(files, TemplateFile{FS: t.FS, Name: name})
 	}
 
-	if funcMap != nil {
-		t.templ = t.templ.Funcs(funcMap)
+	for _, pattern := range t.Patterns {
+		var matches []string
+		var err error
+
+		if t.FS == nil {
+			matches, err = filepath.Glob(pattern)
+		} else {
+			matches, err = fs.Glob(t.FS, pattern)
+		}
+
+		if err != nil {
+			return files, err
+		}
+
+		if len(matches) == 0 {
+			return files, fmt.Errorf("The pattern “%s” matches no files", pattern)
+		}
+
+		for _, name := range matches {
+			files = append(files, TemplateFile{FS: t.FS, Name: name})
+		}
 	}
 
-	t.templ, err = t.templ.ParseFiles(t.Files...)
-	return err
+	for _, other := range t.merged {
+		otherFiles, err := other.resolve()
+		files = append(files, otherFiles...)
+
+		if err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
 }
 
-func (t *TemplateGroup) executeTemplate(w io.Writer, name string, data interface{}) error {
-	return t.templ.ExecuteTemplate(w, name, data)
+func (t *TemplateGroup) parse(files []TemplateFile, leftDelim, rightDelim string, funcMap template.FuncMap) error {
+	if len(files) == 0 {
+		return fmt.Errorf("No template files in the group “%s”", t.Name)
+	}
+
+	templ, err := t.engine().Parse(files, leftDelim, rightDelim, funcMap)
+
+	if err != nil {
+		return err
+	}
+
+	t.templ = templ
+	return nil
+}
+
+func (t *TemplateGroup) engine() Engine {
+	if t.Engine == nil {
+		return HTMLEngine
+	}
+
+	return t.Engine
+}
+
+// defines checks whether the group was parsed with the named template.
+func (t *TemplateGroup) defines(name string) bool {
+	return t.templ != nil && t.templ.Defines(name)
+}
+
+// executeTemplate executes the named template or, if a layout is given,
+// executes the layout with the blocks defined by the named page. The given
+// functions, if any, replace the ones of the same names during this execution
+// only.
+func (t *TemplateGroup) executeTemplate(w io.Writer, layout, name string, data interface{}, funcs template.FuncMap) error {
+	return t.templ.ExecuteTemplate(w, layout, name, data, funcs)
+}
+
+// prototype returns the never executed templates of the group parsed by
+// goEngine, or nil for other engines, whose templates can’t be checked.
+func (t *TemplateGroup) prototype() goTemplate {
+	if templ, ok := t.templ.(*goTemplates); ok {
+		return templ.prototype
+	}
+
+	return nil
+}
+
+// page returns the never executed templates rendering the named page inside
+// the layout, or nil if the group wasn’t parsed by goEngine or if the page
+// isn’t a file of the group.
+func (t *TemplateGroup) page(layout, name string) (goTemplate, error) {
+	if templ, ok := t.templ.(*goTemplates); ok && templ.file(name) != nil {
+		page, err := templ.page(layout, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return page.prototype, nil
+	}
+
+	return nil, nil
 }
 
 // A TemplateGroupSet is a set of TemplateGroups. The set is indexed by the
 // TemplateGroup name. Each handler registers a TemplateGroupSet to be used
 // when a request arrives, using its Templates method.
+//
+// A set can have a layout, a template every page is rendered inside. In this
+// case, the pages define the blocks the layout refers to, instead of
+// including the common templates themselves. For instance, with the layout
+//
+//	<html><title>{{block "title" .}}trama{{end}}</title>{{template "content" .}}</html>
+//
+// a page executed with Response’s ExecuteTemplate would be:
+//
+//	{{define "title"}}Tecendo a manhã{{end}}
+//	{{define "content"}}Um galo sozinho não tece uma manhã{{end}}
+//
+// A block the page doesn’t define gets its default from the layout, and a
+// template without a default, such as “content” above, fails the execution
+// instead of being taken from another page.
 type TemplateGroupSet struct {
 	// FuncMap is a template.FuncMap that can be optionally registered to be
 	// available for the templates in the group set.
-	FuncMap  template.FuncMap
+	FuncMap template.FuncMap
+
+	// Layout is the name of the template the pages of the set are rendered
+	// inside, unless it is overridden by Response’s SetLayout method. If it
+	// is empty, the layout of the Mux’s GlobalTemplates is used, if any.
+	Layout string
+
+	// DefaultGroup is the name of the group where a template is looked for
+	// when it is not found in the group chosen with Response’s
+	// SetTemplateGroup nor in its fallbacks (see TemplateGroup’s Fallback
+	// field). It allows partially translated sites to render the untranslated
+	// pages in a default language. If it is empty, the default group of the
+	// Mux’s GlobalTemplates is used, if any.
+	DefaultGroup string
+
 	elements map[string]*TemplateGroup
+
+	// types holds the types bound to the templates with Bind.
+	types map[string]reflect.Type
 }
 
 // NewTemplateGroupSet creates a new TemplateGroupSet using a possibly nil
@@ -78,7 +288,65 @@ func (t *TemplateGroupSet) find(groupName string) (group *TemplateGroup, found b
 	return
 }
 
+// lookup finds the group defining the named template, trying the given group,
+// then its fallbacks and at last the default group and its fallbacks.
+func (t *TemplateGroupSet) lookup(groupName, name string) (*TemplateGroup, error) {
+	chain := t.chain(groupName)
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("No template group named “%s” was found", groupName)
+	}
+
+	for _, group := range chain {
+		if group.defines(name) {
+			return group, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No template named “%s” was found in the template group “%s” nor in its fallbacks", name, groupName)
+}
+
+// chain lists the existing groups in the order a template is looked for: the
+// given group, its fallbacks and the default group with its fallbacks.
+func (t *TemplateGroupSet) chain(groupName string) []*TemplateGroup {
+	visited := make(map[string]bool)
+	var chain []*TemplateGroup
+	var follow func(string)
+
+	follow = func(groupName string) {
+		if visited[groupName] {
+			return
+		}
+
+		visited[groupName] = true
+
+		if group, found := t.elements[groupName]; found {
+			chain = append(chain, group)
+
+			for _, fallback := range group.Fallback {
+				follow(fallback)
+			}
+		}
+	}
+
+	follow(groupName)
+
+	if t.DefaultGroup != "" {
+		follow(t.DefaultGroup)
+	}
+
+	return chain
+}
+
 func (t *TemplateGroupSet) union(other TemplateGroupSet) error {
+	if t.Layout == "" {
+		t.Layout = other.Layout
+	}
+
+	if t.DefaultGroup == "" {
+		t.DefaultGroup = other.DefaultGroup
+	}
+
 	if len(other.FuncMap) > 0 && t.FuncMap == nil {
 		t.FuncMap = make(template.FuncMap)
 	}
@@ -91,25 +359,244 @@ func (t *TemplateGroupSet) union(other TemplateGroupSet) error {
 		t.FuncMap[k] = v
 	}
 
+	for name, typ := range other.types {
+		if _, found := t.types[name]; !found {
+			if t.types == nil {
+				t.types = make(map[string]reflect.Type)
+			}
+
+			t.types[name] = typ
+		}
+	}
+
 	for name, otherGroup := range other.elements {
 		if group, found := t.elements[name]; found {
 			group.merge(otherGroup)
 		} else {
-			t.elements[name] = otherGroup
+			t.elements[name] = otherGroup.clone()
 		}
 	}
 
 	return nil
 }
 
+// files lists the files of every group in the set, ignoring the patterns
+// that can’t be expanded.
+func (t *TemplateGroupSet) files() []TemplateFile {
+	var files []TemplateFile
+
+	for _, group := range t.elements {
+		groupFiles, _ := group.resolve()
+		files = append(files, groupFiles...)
+	}
+
+	return files
+}
+
+// Parse parses the templates of the set with the default delimiters, so that
+// they can be executed outside an HTTP response with ExecuteTemplate, to send
+// emails for instance. The sets of the handlers are parsed by Mux’s
+// ParseTemplates method instead.
+func (t *TemplateGroupSet) Parse() error {
+	return t.parse("", "")
+}
+
+// ExecuteTemplate writes the named template of the group to w, as Response’s
+// ExecuteTemplate would, looking for it in the group’s fallbacks and in the
+// default group and rendering it inside the set’s layout, if any.
+func (t *TemplateGroupSet) ExecuteTemplate(w io.Writer, groupName, name string, data interface{}) error {
+	group, err := t.lookup(groupName, name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.checkData(name, data); err != nil {
+		return err
+	}
+
+	return group.executeTemplate(w, t.Layout, name, data, nil)
+}
+
 func (t *TemplateGroupSet) parse(leftDelim, rightDelim string) error {
 	for _, group := range t.elements {
-		err := group.parse(leftDelim, rightDelim, t.FuncMap)
+		chain := t.chain(group.Name)
+		files, err := group.resolve()
 
 		if err != nil {
 			return err
 		}
+
+		if len(files) == 0 && group.Catalog != nil {
+			for _, other := range chain[1:] {
+				if files, err = other.resolve(); err != nil {
+					return err
+				}
+
+				if len(files) > 0 {
+					break
+				}
+			}
+		}
+
+		catalogs := make([]*Catalog, len(chain))
+
+		for i, other := range chain {
+			catalogs[i] = other.Catalog
+		}
+
+		// The functions of the group prevail over the ones of the set, which
+		// prevail over the ones of the catalogs.
+		funcMap := catalogFuncs(catalogs)
+
+		for name, f := range t.FuncMap {
+			funcMap[name] = f
+		}
+
+		for name, f := range group.FuncMap {
+			funcMap[name] = f
+		}
+
+		if err := group.parse(files, leftDelim, rightDelim, funcMap); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return t.checkTypes()
+}
+
+// TemplateErrors aggregates the problems found in the templates by Mux’s
+// Validate method.
+type TemplateErrors []error
+
+func (t TemplateErrors) Error() string {
+	messages := make([]string, len(t))
+
+	for i, err := range t {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// validate checks that every group of the parsed set defines, by itself or by
+// its fallbacks, the same templates, including the layout, and that the
+// templates only call templates defined in their groups.
+func (t *TemplateGroupSet) validate() []error {
+	var errs []error
+	var groupNames []string
+	defined := make(map[string]map[string]bool)
+	all := make(map[string]bool)
+
+	if t.Layout != "" {
+		all[t.Layout] = true
+	}
+
+	for name, group := range t.elements {
+		groupNames = append(groupNames, name)
+		defined[name] = make(map[string]bool)
+
+		// The prototype is checked, as the escaping of an executed template
+		// adds templates to it.
+		prototype := group.prototype()
+
+		if prototype == nil {
+			if group.templ == nil {
+				errs = append(errs, fmt.Errorf("The template group “%s” wasn’t parsed", name))
+			}
+
+			continue
+		}
+
+		for _, templ := range prototype.Templates() {
+			if templ.Tree() != nil {
+				defined[name][templ.Name()] = true
+				all[templ.Name()] = true
+			}
+		}
+	}
+
+	sort.Strings(groupNames)
+
+	for _, groupName := range groupNames {
+		prototype := t.elements[groupName].prototype()
+
+		if prototype == nil {
+			continue
+		}
+
+		var missing []string
+
+		for name := range all {
+			found := false
+
+			for _, other := range t.chain(groupName) {
+				if defined[other.Name][name] {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				missing = append(missing, name)
+			}
+		}
+
+		sort.Strings(missing)
+
+		for _, name := range missing {
+			errs = append(errs, fmt.Errorf("The template “%s” isn’t defined in the template group “%s” nor in its fallbacks", name, groupName))
+		}
+
+		var names []string
+
+		for name := range defined[groupName] {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			undefined := make(map[string]bool)
+
+			walkTree(prototype.Lookup(name).Tree().Root, func(node parse.Node) {
+				if node, ok := node.(*parse.TemplateNode); ok && !defined[groupName][node.Name] && !undefined[node.Name] {
+					undefined[node.Name] = true
+					errs = append(errs, fmt.Errorf("The template “%s” of the template group “%s” calls the undefined template “%s”", name, groupName, node.Name))
+				}
+			})
+		}
+	}
+
+	return errs
+}
+
+// walkTree calls visit for the node and each of its descendants which are
+// statements of the template: actions, control structures and template calls.
+func walkTree(node parse.Node, visit func(parse.Node)) {
+	if node == nil {
+		return
+	}
+
+	visit(node)
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+
+		for _, child := range node.Nodes {
+			walkTree(child, visit)
+		}
+	case *parse.IfNode:
+		walkTree(node.List, visit)
+		walkTree(node.ElseList, visit)
+	case *parse.RangeNode:
+		walkTree(node.List, visit)
+		walkTree(node.ElseList, visit)
+	case *parse.WithNode:
+		walkTree(node.List, visit)
+		walkTree(node.ElseList, visit)
+	}
 }
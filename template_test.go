@@ -2,7 +2,14 @@ package trama
 
 import (
 	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 )
 
 func TestInsertInGroupSet(t *testing.T) {
@@ -295,3 +302,443 @@ func subSet(a, b TemplateGroupSet) bool {
 
 	return true
 }
+
+func TestParseFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trama-fs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"cabecalho.html": "Tecendo a manhã",
+		"rodape.html":    "João Cabral de Melo Neto",
+		"leia-me.txt":    "{{não é um template",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	embedded := fstest.MapFS{
+		"templates/pt/poema.html": &fstest.MapFile{
+			Data: []byte(`{{template "cabecalho.html"}}: {{template "verso.html"}} ({{template "rodape.html"}})`),
+		},
+		"templates/pt/verso.html": &fstest.MapFile{
+			Data: []byte(`Um galo sozinho não tece uma manhã`),
+		},
+	}
+
+	data := []struct {
+		description   string
+		group         TemplateGroup
+		global        TemplateGroup
+		template      string
+		expectedBody  string
+		expectedError bool
+	}{
+		{
+			description:  "It should parse embedded templates along with global templates from disk",
+			group:        TemplateGroup{Name: "pt", FS: embedded, Patterns: []string{"templates/pt/*.html"}},
+			global:       TemplateGroup{Name: "pt", Patterns: []string{filepath.Join(dir, "*.html")}},
+			template:     "templates/pt/poema.html",
+			expectedBody: "Tecendo a manhã: Um galo sozinho não tece uma manhã (João Cabral de Melo Neto)",
+		},
+		{
+			description: "It should parse templates from disk along with embedded global templates",
+			group: TemplateGroup{
+				Name:  "pt",
+				Files: []string{filepath.Join(dir, "cabecalho.html"), filepath.Join(dir, "rodape.html")},
+			},
+			global:       TemplateGroup{Name: "pt", FS: embedded, Files: []string{"templates/pt/poema.html", "templates/pt/verso.html"}},
+			template:     "poema.html",
+			expectedBody: "Tecendo a manhã: Um galo sozinho não tece uma manhã (João Cabral de Melo Neto)",
+		},
+		{
+			description:   "It should fail when a pattern matches no files",
+			group:         TemplateGroup{Name: "pt", FS: embedded, Patterns: []string{"templates/en/*.html"}},
+			global:        TemplateGroup{Name: "pt", Patterns: []string{filepath.Join(dir, "*.html")}},
+			expectedError: true,
+		},
+		{
+			description:   "It should fail when a file doesn't exist",
+			group:         TemplateGroup{Name: "pt", FS: embedded, Files: []string{"templates/pt/nada.html"}},
+			global:        TemplateGroup{Name: "pt", Patterns: []string{filepath.Join(dir, "*.html")}},
+			expectedError: true,
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+		set.Insert(item.group)
+		global := NewTemplateGroupSet(nil)
+		global.Insert(item.global)
+
+		if err := set.union(global); err != nil {
+			t.Fatalf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		}
+
+		err := set.parse("", "")
+
+		if item.expectedError {
+			if err == nil {
+				t.Errorf("Item %d, “%s”: no errors found", i, item.description)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		res := &response{templates: set, currentTemplateGroup: "pt", responseWriter: httptest.NewRecorder()}
+		res.ExecuteTemplate(item.template, nil)
+		w := res.responseWriter.(*httptest.ResponseRecorder)
+		res.log = func(err error) { t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err) }
+		res.write()
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected result. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	layouts := fstest.MapFS{
+		"base.html": &fstest.MapFile{
+			Data: []byte(`<h1>{{block "titulo" .}}Poemas{{end}}</h1>{{template "conteudo" .}}`),
+		},
+		"simples.html": &fstest.MapFile{
+			Data: []byte(`{{template "conteudo" .}}`),
+		},
+	}
+
+	pages := fstest.MapFS{
+		"tecendo.html": &fstest.MapFile{
+			Data: []byte(`{{define "titulo"}}Tecendo a manhã{{end}}{{define "conteudo"}}Um {{.}} sozinho não tece uma manhã{{end}}`),
+		},
+		"habitar.html": &fstest.MapFile{
+			Data: []byte(`{{define "conteudo"}}Viver seu tempo{{end}}`),
+		},
+	}
+
+	data := []struct {
+		description    string
+		setLayout      string
+		overrideLayout *string
+		page           string
+		expectedBody   string
+	}{
+		{
+			description:  "It should render the page inside the global layout",
+			page:         "tecendo.html",
+			expectedBody: "<h1>Tecendo a manhã</h1>Um galo sozinho não tece uma manhã",
+		},
+		{
+			description:  "It should use the block default when the page doesn't define it",
+			page:         "habitar.html",
+			expectedBody: "<h1>Poemas</h1>Viver seu tempo",
+		},
+		{
+			description:  "It should render the page inside the layout of the set",
+			setLayout:    "simples.html",
+			page:         "tecendo.html",
+			expectedBody: "Um galo sozinho não tece uma manhã",
+		},
+		{
+			description:    "It should render the page inside the layout of the request",
+			overrideLayout: stringPointer("simples.html"),
+			page:           "habitar.html",
+			expectedBody:   "Viver seu tempo",
+		},
+		{
+			description:    "It should render the page without layout",
+			setLayout:      "simples.html",
+			overrideLayout: stringPointer(""),
+			page:           "tecendo.html",
+			expectedBody:   "",
+		},
+	}
+
+	for i, item := range data {
+		mux := NewMux()
+		mux.SetLogger(func(err error) { t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err) })
+		mux.GlobalTemplates = NewTemplateGroupSet(nil)
+		mux.GlobalTemplates.Layout = "base.html"
+		mux.GlobalTemplates.Insert(TemplateGroup{FS: layouts, Patterns: []string{"*.html"}})
+
+		handler := &layoutHandler{
+			page:     item.page,
+			layout:   item.setLayout,
+			override: item.overrideLayout,
+			pages:    pages,
+		}
+
+		mux.Register("/poema", func() Handler { return handler })
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatalf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		}
+
+		r, err := http.NewRequest("GET", "/poema", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Body.String() != item.expectedBody {
+			t.Errorf("Item %d, “%s”, unexpected result. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+type layoutHandler struct {
+	NopHandler
+	page     string
+	layout   string
+	override *string
+	pages    fstest.MapFS
+}
+
+func (h *layoutHandler) Get(res Response, req *http.Request) error {
+	if h.override != nil {
+		res.SetLayout(*h.override)
+	}
+
+	res.ExecuteTemplate(h.page, "galo")
+	return nil
+}
+
+func (h *layoutHandler) Templates() TemplateGroupSet {
+	set := NewTemplateGroupSet(nil)
+	set.Layout = h.layout
+	set.Insert(TemplateGroup{FS: h.pages, Patterns: []string{"*.html"}})
+	return set
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func TestFallback(t *testing.T) {
+	files := fstest.MapFS{
+		"en/a.html":    &fstest.MapFile{Data: []byte("en a")},
+		"en/b.html":    &fstest.MapFile{Data: []byte("en b")},
+		"en/c.html":    &fstest.MapFile{Data: []byte("en c")},
+		"pt/a.html":    &fstest.MapFile{Data: []byte("pt a")},
+		"pt/b.html":    &fstest.MapFile{Data: []byte("pt b")},
+		"pt-BR/a.html": &fstest.MapFile{Data: []byte("pt-BR a")},
+		"pt-PT/a.html": &fstest.MapFile{Data: []byte("pt-PT a")},
+	}
+
+	set := NewTemplateGroupSet(nil)
+	set.DefaultGroup = "en"
+	set.Insert(TemplateGroup{Name: "en", FS: files, Patterns: []string{"en/*.html"}})
+	set.Insert(TemplateGroup{Name: "pt", FS: files, Patterns: []string{"pt/*.html"}, Fallback: []string{"pt-BR"}})
+	set.Insert(TemplateGroup{Name: "pt-BR", FS: files, Patterns: []string{"pt-BR/*.html"}, Fallback: []string{"pt"}})
+	set.Insert(TemplateGroup{Name: "pt-PT", FS: files, Patterns: []string{"pt-PT/*.html"}, Fallback: []string{"es", "pt"}})
+
+	if err := set.parse("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		description   string
+		group         string
+		template      string
+		expectedGroup string
+		expectedError bool
+	}{
+		{
+			description:   "It should find the template in the group itself",
+			group:         "pt-BR",
+			template:      "a.html",
+			expectedGroup: "pt-BR",
+		},
+		{
+			description:   "It should find the template in the fallback group",
+			group:         "pt-BR",
+			template:      "b.html",
+			expectedGroup: "pt",
+		},
+		{
+			description:   "It should find the template in the default group",
+			group:         "pt-BR",
+			template:      "c.html",
+			expectedGroup: "en",
+		},
+		{
+			description:   "It should skip a fallback group that doesn't exist",
+			group:         "pt-PT",
+			template:      "b.html",
+			expectedGroup: "pt",
+		},
+		{
+			description:   "It should use the default group for an unknown group",
+			group:         "fr",
+			template:      "a.html",
+			expectedGroup: "en",
+		},
+		{
+			description:   "It should fail for an unknown template",
+			group:         "pt",
+			template:      "d.html",
+			expectedError: true,
+		},
+	}
+
+	for i, item := range data {
+		group, err := set.lookup(item.group, item.template)
+
+		if item.expectedError {
+			if err == nil {
+				t.Errorf("Item %d, “%s”: no errors found", i, item.description)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+		} else if group.Name != item.expectedGroup {
+			t.Errorf("Item %d, “%s”, wrong group. Expecting “%s”; found “%s”", i, item.description, item.expectedGroup, group.Name)
+		}
+	}
+
+	set.DefaultGroup = ""
+
+	if _, err := set.lookup("fr", "a.html"); err == nil {
+		t.Error("No errors found for an unknown group without default group")
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	files := fstest.MapFS{
+		"layout.html": &fstest.MapFile{Data: []byte(`{{block "content" .}}{{end}} ({{user}})`)},
+		"page.html":   &fstest.MapFile{Data: []byte(`{{define "content"}}{{greeting}}, {{user}}{{end}}`)},
+		"plain.html":  &fstest.MapFile{Data: []byte(`{{greeting}}, {{user}}`)},
+	}
+
+	data := []struct {
+		description    string
+		group          string
+		template       string
+		layout         bool
+		user           string
+		expectedResult string
+	}{
+		{
+			description:    "It should use the placeholder without request-scoped functions",
+			group:          "en",
+			template:       "plain.html",
+			expectedResult: "Hello, nobody",
+		},
+		{
+			description:    "It should prefer the group’s functions",
+			group:          "pt",
+			template:       "plain.html",
+			expectedResult: "Olá, nobody",
+		},
+		{
+			description:    "It should bind the request-scoped functions",
+			group:          "pt",
+			template:       "plain.html",
+			user:           "João",
+			expectedResult: "Olá, João",
+		},
+		{
+			description:    "It should bind the request-scoped functions inside a layout",
+			group:          "en",
+			template:       "page.html",
+			layout:         true,
+			user:           "Cabral",
+			expectedResult: "Hello, Cabral (Cabral)",
+		},
+		{
+			description:    "It shouldn't keep the functions of a previous request",
+			group:          "en",
+			template:       "page.html",
+			layout:         true,
+			expectedResult: "Hello, nobody (nobody)",
+		},
+	}
+
+	mux := NewMux()
+	mux.SetLogger(func(err error) { t.Error("Unexpected error:", err) })
+
+	handler := &funcsHandler{files: files}
+	mux.Register("/", func() Handler { return handler })
+
+	if err := mux.ParseTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, item := range data {
+		handler.group = item.group
+		handler.template = item.template
+		handler.layout = item.layout
+		handler.user = item.user
+
+		r, err := http.NewRequest("GET", "/", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if body := w.Body.String(); body != item.expectedResult {
+			t.Errorf("Item %d, “%s”, wrong result. Expecting “%s”; found “%s”", i, item.description, item.expectedResult, body)
+		}
+	}
+}
+
+type funcsHandler struct {
+	NopHandler
+	files    fs.FS
+	group    string
+	template string
+	layout   bool
+	user     string
+}
+
+func (h *funcsHandler) Templates() TemplateGroupSet {
+	set := NewTemplateGroupSet(template.FuncMap{
+		"greeting": func() string { return "Hello" },
+		"user":     func() string { return "nobody" },
+	})
+
+	set.Insert(TemplateGroup{Name: "en", FS: h.files, Patterns: []string{"*.html"}})
+	set.Insert(TemplateGroup{
+		Name:     "pt",
+		FS:       h.files,
+		Patterns: []string{"*.html"},
+		FuncMap:  template.FuncMap{"greeting": func() string { return "Olá" }},
+	})
+
+	return set
+}
+
+func (h *funcsHandler) Get(res Response, r *http.Request) error {
+	res.SetTemplateGroup(h.group)
+
+	if h.layout {
+		res.SetLayout("layout.html")
+	}
+
+	if h.user != "" {
+		user := h.user
+		res.SetTemplateFuncs(template.FuncMap{"user": func() string { return user }})
+	}
+
+	res.ExecuteTemplate(h.template, nil)
+	return nil
+}
@@ -0,0 +1,107 @@
+package trama
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// TxSetter is implemented by the handlers receiving the transaction of a
+// Transaction interceptor.
+type TxSetter interface {
+	SetTx(*sql.Tx)
+}
+
+// Transaction is an interceptor running the handler inside a database
+// transaction, begun in Before and given to the target, usually the handler
+// itself:
+//
+//	type handler struct {
+//		trama.NopHandler
+//		tx *sql.Tx
+//	}
+//
+//	func (h *handler) SetTx(tx *sql.Tx) {
+//		h.tx = tx
+//	}
+//
+//	func (h *handler) Interceptors() trama.InterceptorChain {
+//		return trama.NewInterceptorChain(trama.NewTransaction(db, h))
+//	}
+//
+// The transaction is committed in After if no error was returned and the
+// status code of the response is below 400; otherwise, it is rolled back. By
+// default, the transactions of GET and HEAD requests are read-only (see the
+// ReadOnly field). As the transaction is bound to the request’s context, it is
+// rolled back by the database if the client goes away. A failed commit
+// replaces the response with a 500 (Internal Server Error), unless the handler
+// already finished the transaction itself; a transaction rolled back because
+// the request’s context is done is a failed commit as well.
+type Transaction struct {
+	NopInterceptor
+	db     *sql.DB
+	target TxSetter
+	tx     *sql.Tx
+	ctx    context.Context
+
+	// Isolation is the isolation level of the transactions. The zero value is
+	// the driver’s default level.
+	Isolation sql.IsolationLevel
+
+	// ReadOnly decides whether the transaction of the request is read-only.
+	// If it is nil, the transactions of GET and HEAD requests are read-only;
+	// a function always returning false suits the drivers refusing read-only
+	// transactions.
+	ReadOnly func(*http.Request) bool
+}
+
+// NewTransaction creates a Transaction beginning the transactions in db.
+func NewTransaction(db *sql.DB, target TxSetter) *Transaction {
+	return &Transaction{db: db, target: target}
+}
+
+// Before begins the transaction and gives it to the target.
+func (t *Transaction) Before(res Response, r *http.Request) error {
+	readOnly := r.Method == "GET" || r.Method == "HEAD"
+
+	if t.ReadOnly != nil {
+		readOnly = t.ReadOnly(r)
+	}
+
+	tx, err := t.db.BeginTx(r.Context(), &sql.TxOptions{Isolation: t.Isolation, ReadOnly: readOnly})
+
+	if err != nil {
+		return err
+	}
+
+	t.tx = tx
+	t.ctx = r.Context()
+	t.target.SetTx(tx)
+	return nil
+}
+
+// After commits or rolls back the transaction.
+func (t *Transaction) After(res Response, r *http.Request, err error) {
+	if t.tx == nil {
+		return
+	}
+
+	if err != nil || res.Status() >= http.StatusBadRequest {
+		t.tx.Rollback()
+		return
+	}
+
+	err = t.tx.Commit()
+
+	if errors.Is(err, sql.ErrTxDone) && t.ctx.Err() != nil {
+		// The transaction wasn’t finished by the handler, but rolled back
+		// by database/sql when the request’s context was done.
+		err = fmt.Errorf("The transaction was rolled back: %w", t.ctx.Err())
+	} else if err == nil || errors.Is(err, sql.ErrTxDone) {
+		return
+	}
+
+	res.Fail(err)
+}
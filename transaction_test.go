@@ -0,0 +1,290 @@
+package trama
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransaction(t *testing.T) {
+	data := []struct {
+		description    string
+		method         string
+		status         int
+		err            error
+		beginErr       error
+		commitErr      error
+		readOnly       func(*http.Request) bool
+		expectedStatus int
+		expectedEvents []string
+	}{
+		{
+			description:    "It should commit a successful request",
+			method:         "POST",
+			status:         http.StatusCreated,
+			expectedStatus: http.StatusCreated,
+			expectedEvents: []string{"begin", "commit"},
+		},
+		{
+			description:    "It should begin a read-only transaction for GET",
+			method:         "GET",
+			status:         http.StatusOK,
+			expectedStatus: http.StatusOK,
+			expectedEvents: []string{"begin read-only", "commit"},
+		},
+		{
+			description:    "It should let the caller decide whether the transaction is read-only",
+			method:         "GET",
+			status:         http.StatusOK,
+			readOnly:       func(*http.Request) bool { return false },
+			expectedStatus: http.StatusOK,
+			expectedEvents: []string{"begin", "commit"},
+		},
+		{
+			description:    "It should roll back when the handler returns an error",
+			method:         "POST",
+			err:            NewHTTPError(http.StatusConflict, "", nil),
+			expectedStatus: http.StatusConflict,
+			expectedEvents: []string{"begin", "rollback"},
+		},
+		{
+			description:    "It should roll back when the status is an error",
+			method:         "POST",
+			status:         http.StatusBadRequest,
+			expectedStatus: http.StatusBadRequest,
+			expectedEvents: []string{"begin", "rollback"},
+		},
+		{
+			description:    "It should write a failed commit as a server error",
+			method:         "POST",
+			status:         http.StatusOK,
+			commitErr:      errors.New("Serialization failure"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedEvents: []string{"begin", "commit"},
+		},
+		{
+			description:    "It should interrupt the chain when the transaction can’t begin",
+			method:         "POST",
+			beginErr:       errors.New("Too many connections"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for i, item := range data {
+		connector := &txConnector{beginErr: item.beginErr, commitErr: item.commitErr}
+		db := sql.OpenDB(connector)
+		handler := &txHandler{db: db, status: item.status, err: item.err, readOnly: item.readOnly}
+
+		var errs []error
+		mux := NewMux()
+		mux.SetLogger(func(err error) { errs = append(errs, err) })
+		mux.Register("/", func() Handler { return handler })
+
+		r := httptest.NewRequest(item.method, "/", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		db.Close()
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if events := connector.recorded(); !reflect.DeepEqual(events, item.expectedEvents) {
+			t.Errorf("Item %d, “%s”, wrong events. Expecting %v; found %v", i, item.description, item.expectedEvents, events)
+		}
+
+		if item.commitErr != nil && (len(errs) != 1 || !errors.Is(errs[0], item.commitErr)) {
+			t.Errorf("Item %d, “%s”, the failed commit wasn’t logged: %v", i, item.description, errs)
+		}
+	}
+}
+
+func TestTransactionCanceled(t *testing.T) {
+	connector := &txConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	handler := &txHandler{db: db, status: http.StatusOK, cancelable: true, connector: connector}
+
+	var errs []error
+	mux := NewMux()
+	mux.SetLogger(func(err error) { errs = append(errs, err) })
+	mux.Register("/", func() Handler { return handler })
+
+	r := httptest.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Wrong status code. Expecting %d; found %d", http.StatusInternalServerError, w.Code)
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("The rolled back transaction wasn’t logged: %v", errs)
+	}
+
+	for _, event := range connector.recorded() {
+		if event == "commit" {
+			t.Error("The transaction was committed")
+		}
+	}
+}
+
+type txHandler struct {
+	NopHandler
+	db     *sql.DB
+	tx     *sql.Tx
+	status int
+	err    error
+
+	// cancelable makes the handler cancel the request’s context, as if
+	// its deadline expired.
+	cancelable bool
+	cancel     context.CancelFunc
+	connector  *txConnector
+	readOnly   func(*http.Request) bool
+}
+
+func (h *txHandler) SetTx(tx *sql.Tx) {
+	h.tx = tx
+}
+
+func (h *txHandler) Interceptors() InterceptorChain {
+	if h.cancelable {
+		return NewInterceptorChain(&cancelInterceptor{h}, NewTransaction(h.db, h))
+	}
+
+	transaction := NewTransaction(h.db, h)
+	transaction.ReadOnly = h.readOnly
+	return NewInterceptorChain(transaction)
+}
+
+func (h *txHandler) Get(res Response, req *http.Request) error {
+	if h.tx == nil {
+		return errors.New("No transaction")
+	}
+
+	if h.err != nil {
+		return h.err
+	}
+
+	if h.cancel != nil {
+		h.cancel()
+
+		// The transaction is rolled back by database/sql in background.
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if events := h.connector.recorded(); events[len(events)-1] == "rollback" {
+				break
+			}
+		}
+	}
+
+	res.SetStatus(h.status)
+	res.Write([]byte("OK"))
+	return nil
+}
+
+func (h *txHandler) Post(res Response, req *http.Request) error {
+	return h.Get(res, req)
+}
+
+type cancelInterceptor struct {
+	handler *txHandler
+}
+
+func (c *cancelInterceptor) Before(res Response, r *http.Request) error {
+	ctx, cancel := context.WithCancel(r.Context())
+	res.WithContext(ctx)
+	c.handler.cancel = cancel
+	return nil
+}
+
+func (c *cancelInterceptor) After(Response, *http.Request, error) {
+	c.handler.cancel()
+}
+
+// txConnector is a database/sql driver recording the transactions.
+type txConnector struct {
+	beginErr  error
+	commitErr error
+
+	mutex  sync.Mutex
+	events []string
+}
+
+func (c *txConnector) Connect(context.Context) (driver.Conn, error) {
+	return txConn{c}, nil
+}
+
+func (c *txConnector) Driver() driver.Driver {
+	return txDriver{}
+}
+
+func (c *txConnector) record(event string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *txConnector) recorded() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.events
+}
+
+type txDriver struct{}
+
+func (txDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("Not supported")
+}
+
+type txConn struct {
+	connector *txConnector
+}
+
+func (c txConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("Not supported")
+}
+
+func (c txConn) Close() error {
+	return nil
+}
+
+func (c txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.connector.beginErr != nil {
+		return nil, c.connector.beginErr
+	}
+
+	if opts.ReadOnly {
+		c.connector.record("begin read-only")
+	} else {
+		c.connector.record("begin")
+	}
+
+	return txTx{c.connector}, nil
+}
+
+type txTx struct {
+	connector *txConnector
+}
+
+func (t txTx) Commit() error {
+	t.connector.record("commit")
+	return t.connector.commitErr
+}
+
+func (t txTx) Rollback() error {
+	t.connector.record("rollback")
+	return nil
+}
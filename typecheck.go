@@ -0,0 +1,308 @@
+package trama
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"text/template/parse"
+)
+
+// Bind declares the type of the data the named template is executed with,
+// given as a value, or a nil pointer, of that type. When the set is parsed,
+// the fields and methods the template refers to, following {{with}},
+// {{range}} and the templates it calls, are checked against the type; and
+// Response’s ExecuteTemplate rejects data of another type, which is then
+// written as a 500 (Internal Server Error). A pointer to the type is also
+// accepted as data.
+//
+//	set.Bind("poema.html", Poem{})
+func (t *TemplateGroupSet) Bind(name string, data interface{}) {
+	typ := reflect.TypeOf(data)
+
+	if typ == nil {
+		panic(fmt.Sprintf("trama: no type given for the template “%s”", name))
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if t.types == nil {
+		t.types = make(map[string]reflect.Type)
+	}
+
+	t.types[name] = typ
+}
+
+// checkData checks the data the named template is going to be executed with
+// against the type bound to the template, if any.
+func (t *TemplateGroupSet) checkData(name string, data interface{}) error {
+	expected, found := t.types[name]
+
+	if !found {
+		return nil
+	}
+
+	typ := reflect.TypeOf(data)
+
+	if typ != nil && (typ.AssignableTo(expected) || typ.Kind() == reflect.Ptr && typ.Elem().AssignableTo(expected)) {
+		return nil
+	}
+
+	return fmt.Errorf("The template “%s” expects data of the type %s; found %T", name, expected, data)
+}
+
+// checkTypes checks the templates bound to a type in every group of the parsed
+// set. The templates rendered inside the layout are checked along with it.
+func (t *TemplateGroupSet) checkTypes() error {
+	var groupNames, names []string
+
+	for name := range t.elements {
+		groupNames = append(groupNames, name)
+	}
+
+	for name := range t.types {
+		names = append(names, name)
+	}
+
+	sort.Strings(groupNames)
+	sort.Strings(names)
+
+	var errs TemplateErrors
+
+	for _, groupName := range groupNames {
+		group := t.elements[groupName]
+
+		for _, name := range names {
+			prototype := group.prototype()
+
+			if prototype == nil || prototype.Lookup(name) == nil {
+				continue
+			}
+
+			checker := newTypeChecker(prototype, groupName)
+			checker.checkTemplate(name, t.types[name])
+
+			if t.Layout != "" && prototype.Lookup(t.Layout) != nil {
+				page, err := group.page(t.Layout, name)
+
+				if err != nil {
+					return err
+				}
+
+				if page != nil {
+					checker.templ = page
+					checker.checkTemplate(t.Layout, t.types[name])
+				}
+			}
+
+			errs = append(errs, checker.errs...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// typeChecker walks the parse trees of the templates following the type of
+// dot. A nil type stands for a value whose type can’t be known before the
+// execution, like the result of a function or an interface, which isn’t
+// checked.
+type typeChecker struct {
+	templ   goTemplate
+	group   string
+	visited map[typeCheckKey]bool
+	errs    []error
+}
+
+type typeCheckKey struct {
+	templ goTemplate
+	name  string
+	typ   reflect.Type
+}
+
+func newTypeChecker(templ goTemplate, group string) *typeChecker {
+	return &typeChecker{templ: templ, group: group, visited: make(map[typeCheckKey]bool)}
+}
+
+func (c *typeChecker) checkTemplate(name string, dot reflect.Type) {
+	templ := c.templ.Lookup(name)
+
+	if templ == nil || templ.Tree() == nil || dot == nil {
+		return
+	}
+
+	key := typeCheckKey{c.templ, name, dot}
+
+	if c.visited[key] {
+		return
+	}
+
+	c.visited[key] = true
+	c.checkNode(templ.Tree(), templ.Tree().Root, dot, dot)
+}
+
+// checkNode checks the statement with the given types of dot and of $.
+func (c *typeChecker) checkNode(tree *parse.Tree, node parse.Node, dot, root reflect.Type) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+
+		for _, child := range node.Nodes {
+			c.checkNode(tree, child, dot, root)
+		}
+	case *parse.ActionNode:
+		c.pipeType(tree, node.Pipe, dot, root)
+	case *parse.IfNode:
+		c.pipeType(tree, node.Pipe, dot, root)
+		c.checkNode(tree, node.List, dot, root)
+		c.checkNode(tree, node.ElseList, dot, root)
+	case *parse.RangeNode:
+		typ := c.pipeType(tree, node.Pipe, dot, root)
+		c.checkNode(tree, node.List, elemType(typ), root)
+		c.checkNode(tree, node.ElseList, dot, root)
+	case *parse.WithNode:
+		typ := c.pipeType(tree, node.Pipe, dot, root)
+		c.checkNode(tree, node.List, typ, root)
+		c.checkNode(tree, node.ElseList, dot, root)
+	case *parse.TemplateNode:
+		if node.Pipe != nil {
+			c.checkTemplate(node.Name, c.pipeType(tree, node.Pipe, dot, root))
+		}
+	}
+}
+
+// pipeType checks the pipeline and returns the type of its result.
+func (c *typeChecker) pipeType(tree *parse.Tree, pipe *parse.PipeNode, dot, root reflect.Type) reflect.Type {
+	if pipe == nil {
+		return nil
+	}
+
+	var typ reflect.Type
+
+	for _, cmd := range pipe.Cmds {
+		typ = nil
+
+		for i, arg := range cmd.Args {
+			argType := c.argType(tree, arg, dot, root)
+
+			if i == 0 {
+				typ = argType
+			}
+		}
+
+		if _, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+			typ = nil
+		}
+	}
+
+	return typ
+}
+
+// argType checks the argument and returns its type.
+func (c *typeChecker) argType(tree *parse.Tree, arg parse.Node, dot, root reflect.Type) reflect.Type {
+	switch arg := arg.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return c.fieldType(tree, arg, dot, arg.Ident)
+	case *parse.VariableNode:
+		if arg.Ident[0] == "$" {
+			return c.fieldType(tree, arg, root, arg.Ident[1:])
+		}
+	case *parse.ChainNode:
+		return c.fieldType(tree, arg, c.argType(tree, arg.Node, dot, root), arg.Field)
+	case *parse.PipeNode:
+		return c.pipeType(tree, arg, dot, root)
+	}
+
+	return nil
+}
+
+// fieldType follows the chain of fields from the type, reporting the fields
+// it doesn’t have.
+func (c *typeChecker) fieldType(tree *parse.Tree, node parse.Node, typ reflect.Type, fields []string) reflect.Type {
+	for _, field := range fields {
+		if typ == nil {
+			return nil
+		}
+
+		next, ok := fieldOrMethod(typ, field)
+
+		if !ok {
+			location, _ := tree.ErrorContext(node)
+			c.errs = append(c.errs, fmt.Errorf("The field “%s” doesn’t exist in the type %s, at %s in the template group “%s”", field, typ, location, c.group))
+			return nil
+		}
+
+		typ = next
+	}
+
+	return typ
+}
+
+// fieldOrMethod finds the type of the named field or method result, as
+// evaluated by the templates. The type is nil if it can’t be known.
+func fieldOrMethod(typ reflect.Type, name string) (reflect.Type, bool) {
+	if typ.Kind() == reflect.Interface {
+		return nil, true
+	}
+
+	pointer := typ
+
+	if typ.Kind() != reflect.Ptr {
+		pointer = reflect.PtrTo(typ)
+	}
+
+	if method, found := pointer.MethodByName(name); found {
+		if method.Type.NumOut() == 0 {
+			return nil, true
+		}
+
+		return method.Type.Out(0), true
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if field, found := typ.FieldByName(name); found && field.PkgPath == "" {
+			return field.Type, true
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String {
+			return typ.Elem(), true
+		}
+	case reflect.Interface:
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// elemType returns the type of dot inside a {{range}} over the type.
+func elemType(typ reflect.Type) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return typ.Elem()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return typ
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package trama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type poemData struct {
+	Title  string
+	Author *author
+	Verses []verse
+	Notes  map[string]string
+	Extra  interface{}
+}
+
+type author struct {
+	Name string
+}
+
+func (a author) Initials() string {
+	return a.Name[:1]
+}
+
+type verse struct {
+	Text string
+}
+
+func TestBind(t *testing.T) {
+	data := []struct {
+		description    string
+		content        string
+		layout         string
+		expectedErrors []string
+	}{
+		{
+			description: "It should accept the fields of the type",
+			content: `{{.Title}} {{.Author.Name}} {{.Author.Initials}} {{$.Notes.any}} {{.Extra.Whatever}}
+				{{range .Verses}}{{.Text}} {{$.Title}}{{end}}
+				{{with .Author}}{{.Name}}{{else}}{{.Title}}{{end}}
+				{{template "verses" .Verses}}{{printf "%s" .Title | len}}
+				{{define "verses"}}{{range .}}{{.Text}}{{end}}{{end}}`,
+		},
+		{
+			description: "It should report the fields not found in the type",
+			content: `{{.Titulo}} {{.Author.Nome}}
+				{{range .Verses}}{{.Title}}{{end}}
+				{{with .Author}}{{.Title}}{{end}}
+				{{printf "%s" .Autor}}`,
+			expectedErrors: []string{
+				"The field “Titulo” doesn’t exist in the type trama.poemData, at poema.html:1:2 in the template group “pt”",
+				"The field “Nome” doesn’t exist in the type *trama.author, at poema.html:1:21 in the template group “pt”",
+				"The field “Title” doesn’t exist in the type trama.verse, at poema.html:2:23 in the template group “pt”",
+				"The field “Title” doesn’t exist in the type *trama.author, at poema.html:3:22 in the template group “pt”",
+				"The field “Autor” doesn’t exist in the type trama.poemData, at poema.html:4:18 in the template group “pt”",
+			},
+		},
+		{
+			description: "It should follow the called templates",
+			content:     `{{template "verses" .Verses}}{{define "verses"}}{{range .}}{{.Texto}}{{end}}{{end}}`,
+			expectedErrors: []string{
+				"The field “Texto” doesn’t exist in the type trama.verse, at poema.html:1:61 in the template group “pt”",
+			},
+		},
+		{
+			description: "It should check the blocks of the page inside the layout",
+			content:     `{{define "content"}}{{.Titulo}}{{end}}`,
+			layout:      "layout.html",
+			expectedErrors: []string{
+				"The field “Titulo” doesn’t exist in the type trama.poemData, at poema.html:1:22 in the template group “pt”",
+			},
+		},
+	}
+
+	for i, item := range data {
+		files := fstest.MapFS{
+			"poema.html":  &fstest.MapFile{Data: []byte(item.content)},
+			"layout.html": &fstest.MapFile{Data: []byte(`{{block "content" .}}{{.Title}}{{end}}`)},
+		}
+
+		set := NewTemplateGroupSet(nil)
+		set.Layout = item.layout
+		set.Insert(TemplateGroup{Name: "pt", FS: files, Patterns: []string{"*.html"}})
+		set.Bind("poema.html", &poemData{})
+
+		err := set.parse("", "")
+
+		if len(item.expectedErrors) == 0 {
+			if err != nil {
+				t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			}
+
+			continue
+		}
+
+		errs, ok := err.(TemplateErrors)
+
+		if !ok {
+			t.Errorf("Item %d, “%s”, unexpected error: “%v”", i, item.description, err)
+			continue
+		}
+
+		if len(errs) != len(item.expectedErrors) {
+			t.Errorf("Item %d, “%s”, wrong number of errors. Expecting %d; found %d:\n%s", i, item.description, len(item.expectedErrors), len(errs), errs)
+			continue
+		}
+
+		for k, err := range errs {
+			if err.Error() != item.expectedErrors[k] {
+				t.Errorf("Item %d, “%s”, wrong error. Expecting “%s”; found “%s”", i, item.description, item.expectedErrors[k], err)
+			}
+		}
+	}
+}
+
+func TestBindExecute(t *testing.T) {
+	files := fstest.MapFS{
+		"poema.html": &fstest.MapFile{Data: []byte(`{{.Title}}`)},
+	}
+
+	data := []struct {
+		description    string
+		data           interface{}
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "It should accept data of the bound type",
+			data:           poemData{Title: "Tecendo a manhã"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Tecendo a manhã",
+		},
+		{
+			description:    "It should accept a pointer to the bound type",
+			data:           &poemData{Title: "Tecendo a manhã"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Tecendo a manhã",
+		},
+		{
+			description:    "It should reject data of another type",
+			data:           struct{ Title string }{"Tecendo a manhã"},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			description:    "It should reject nil data",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for i, item := range data {
+		set := NewTemplateGroupSet(nil)
+		set.Insert(TemplateGroup{FS: files, Patterns: []string{"*.html"}})
+		set.Bind("poema.html", poemData{})
+
+		var errs []error
+		mux := NewMux()
+		mux.SetLogger(func(err error) { errs = append(errs, err) })
+		mux.Register("/", func() Handler {
+			return &renderHandler{templates: set, template: "poema.html", data: item.data}
+		})
+
+		if err := mux.ParseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := http.NewRequest("GET", "/", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if body := w.Body.String(); body != item.expectedBody {
+			t.Errorf("Item %d, “%s”, wrong body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, body)
+		}
+
+		if item.expectedStatus == http.StatusInternalServerError {
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), "expects data of the type trama.poemData") {
+				t.Errorf("Item %d, “%s”, unexpected errors: %v", i, item.description, errs)
+			}
+		}
+	}
+}
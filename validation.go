@@ -0,0 +1,394 @@
+package trama
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is an interceptor checking the fields of a struct, usually the
+// handler itself after a Binder filled it, against the rules of their validate
+// tags:
+//
+//	type handler struct {
+//		trama.NopHandler
+//		Name   string   `form:"name" validate:"required,max=100"`
+//		Email  string   `form:"email" validate:"required,email"`
+//		Age    int      `form:"age" validate:"min=18"`
+//		Kind   string   `form:"kind" validate:"enum=person|company"`
+//		Code   string   `form:"code" validate:"regex=^[A-Z]{3}$"`
+//		Domain string   `form:"domain" validate:"required,domain"`
+//		Errors trama.ValidationErrors
+//	}
+//
+//	func (h *handler) Interceptors() trama.InterceptorChain {
+//		validator := trama.NewValidator(h)
+//		validator.Funcs = map[string]trama.ValidationFunc{"domain": checkDomain}
+//		return trama.NewInterceptorChain(trama.NewBinder(h), validator)
+//	}
+//
+//	func (h *handler) SetValidationErrors(errs trama.ValidationErrors) {
+//		h.Errors = errs
+//	}
+//
+// The rules are:
+//
+//	required     the value can’t be the zero value of its type
+//	min=n, max=n the bounds of a number, or of the length of a string, slice
+//	             or map
+//	regex=expr   a string must match the regular expression, which takes
+//	             the rest of the tag, commas included
+//	email        a string must be an email address
+//	enum=a|b     the value must be one of the options
+//	name         the ValidationFunc with that name in the Funcs field
+//
+// Every rule but required accepts a nil pointer and an empty string, slice or
+// map, so that optional fields can be left empty. A number or a boolean is
+// always checked, as its zero value can’t be told apart from a value provided
+// by the client: an optional number should be a pointer. The fields of
+// anonymous structs and of the field tagged json:"body" are checked as well. A
+// field is named in the errors after its form, query, path or json tag, or
+// else after itself.
+//
+// When a field breaks its rules, the target receives the errors if it
+// implements ValidationErrorsSetter, so that the handler can show them along
+// with the form; otherwise, the chain is interrupted with a 422 (Unprocessable
+// Entity) HTTPError.
+type Validator struct {
+	NopInterceptor
+	target interface{}
+
+	// Funcs holds the custom rules, by name.
+	Funcs map[string]ValidationFunc
+}
+
+// A ValidationFunc checks the value of a field, returning the error to be shown
+// if it is invalid. The value is the field itself, even when it is the zero
+// value of its type.
+type ValidationFunc func(value interface{}) error
+
+// ValidationErrorsSetter is implemented by the targets of a Validator that
+// handle the errors themselves.
+type ValidationErrorsSetter interface {
+	SetValidationErrors(ValidationErrors)
+}
+
+// ValidationError is a field breaking one of its rules.
+type ValidationError struct {
+	// Field is the name of the field (see Validator).
+	Field string
+
+	// Rule is the name of the broken rule, such as “required” or “min”.
+	Rule string
+
+	// Message describes the problem, safe to be shown to the client.
+	Message string
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Message)
+}
+
+// ValidationErrors aggregates the rules broken by the fields of a struct.
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+
+	for i, err := range v {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Message returns the message of the first rule broken by the named field, or
+// an empty string if the field is valid, to be used by the templates:
+//
+//	{{with .Errors.Message "email"}}<span class="error">{{.}}</span>{{end}}
+func (v ValidationErrors) Message(field string) string {
+	for _, err := range v {
+		if err.Field == field {
+			return err.Message
+		}
+	}
+
+	return ""
+}
+
+// NewValidator creates a Validator checking target, which must be a pointer to
+// a struct.
+func NewValidator(target interface{}) *Validator {
+	return &Validator{target: target}
+}
+
+// Before checks the fields of the target.
+func (v *Validator) Before(res Response, r *http.Request) error {
+	value := reflect.ValueOf(v.target)
+
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Can’t validate a %T; a pointer to a struct is expected", v.target)
+	}
+
+	var errs ValidationErrors
+
+	if err := v.validateStruct(value.Elem(), &errs); err != nil {
+		return err
+	}
+
+	if setter, ok := v.target.(ValidationErrorsSetter); ok {
+		setter.SetValidationErrors(errs)
+		return nil
+	}
+
+	if len(errs) > 0 {
+		return NewHTTPError(http.StatusUnprocessableEntity, errs.Error(), errs)
+	}
+
+	return nil
+}
+
+// validateStruct appends the rules broken by the fields of the struct to errs.
+// The returned error is a mistake in the rules themselves.
+func (v *Validator) validateStruct(value reflect.Value, errs *ValidationErrors) error {
+	typ := value.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct ||
+			field.Tag.Get("json") == "body" && field.Type.Kind() == reflect.Struct {
+
+			if err := v.validateStruct(value.Field(i), errs); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+
+		if field.PkgPath != "" || tag == "" {
+			continue
+		}
+
+		name := fieldName(field)
+
+		for _, rule := range splitRules(tag) {
+			message, err := v.check(value.Field(i), rule)
+
+			if err != nil {
+				return fmt.Errorf("Invalid rule “%s” of the field “%s”: %s", rule, name, err)
+			}
+
+			if message != "" {
+				ruleName := strings.SplitN(rule, "=", 2)[0]
+				*errs = append(*errs, ValidationError{Field: name, Rule: ruleName, Message: message})
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldName names the field after the tag binding it, if any.
+func fieldName(field reflect.StructField) string {
+	for _, source := range []string{"form", "query", "path", "json"} {
+		name := strings.Split(field.Tag.Get(source), ",")[0]
+
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// splitRules splits the tag on its commas, except for the ones of a regular
+// expression, which ends the tag.
+func splitRules(tag string) []string {
+	var rules []string
+
+	for tag != "" {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(rules, tag)
+		}
+
+		parts := strings.SplitN(tag, ",", 2)
+		rules = append(rules, strings.TrimSpace(parts[0]))
+
+		if len(parts) == 1 {
+			break
+		}
+
+		tag = parts[1]
+	}
+
+	return rules
+}
+
+// check returns the message of the broken rule, or an empty string if the
+// value follows it.
+func (v *Validator) check(value reflect.Value, rule string) (string, error) {
+	parts := strings.SplitN(rule, "=", 2)
+	name, param := parts[0], ""
+
+	if len(parts) == 2 {
+		param = parts[1]
+	}
+
+	if name == "required" {
+		if value.IsZero() {
+			return "This field is required", nil
+		}
+
+		return "", nil
+	}
+
+	if fn, found := v.Funcs[name]; found {
+		if err := fn(value.Interface()); err != nil {
+			return err.Error(), nil
+		}
+
+		return "", nil
+	}
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", nil
+		}
+
+		value = value.Elem()
+	}
+
+	if !provided(value) {
+		return "", nil
+	}
+
+	switch name {
+	case "min", "max":
+		return checkBound(value, name, param)
+
+	case "regex":
+		expr, err := compileRegexp(param)
+
+		if err != nil {
+			return "", err
+		}
+
+		if value.Kind() != reflect.String {
+			return "", fmt.Errorf("The type %s isn’t a string", value.Type())
+		}
+
+		if !expr.MatchString(value.String()) {
+			return "The value doesn’t have the expected format", nil
+		}
+
+	case "email":
+		if value.Kind() != reflect.String {
+			return "", fmt.Errorf("The type %s isn’t a string", value.Type())
+		}
+
+		address, err := mail.ParseAddress(value.String())
+
+		if err != nil || address.Address != value.String() {
+			return "Invalid email address", nil
+		}
+
+	case "enum":
+		options := strings.Split(param, "|")
+		current := fmt.Sprint(value.Interface())
+
+		for _, option := range options {
+			if option == current {
+				return "", nil
+			}
+		}
+
+		return fmt.Sprintf("The value must be one of: %s", strings.Join(options, ", ")), nil
+
+	default:
+		return "", fmt.Errorf("Unknown rule")
+	}
+
+	return "", nil
+}
+
+// provided checks whether the value was filled, telling apart the empty
+// strings, slices and maps of the optional fields from the numbers and
+// booleans, whose zero value is a value like any other.
+func provided(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() > 0
+	}
+
+	return true
+}
+
+// checkBound compares a number, or the length of a string, slice or map, to
+// the bound of a min or max rule.
+func checkBound(value reflect.Value, rule, param string) (string, error) {
+	bound, err := strconv.ParseFloat(param, 64)
+
+	if err != nil {
+		return "", err
+	}
+
+	var n float64
+	length := false
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	case reflect.String:
+		n, length = float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, length = float64(value.Len()), true
+	default:
+		return "", fmt.Errorf("The type %s has no size", value.Type())
+	}
+
+	switch {
+	case rule == "min" && n < bound && length:
+		return fmt.Sprintf("The minimum length is %s", param), nil
+	case rule == "min" && n < bound:
+		return fmt.Sprintf("The minimum value is %s", param), nil
+	case rule == "max" && n > bound && length:
+		return fmt.Sprintf("The maximum length is %s", param), nil
+	case rule == "max" && n > bound:
+		return fmt.Sprintf("The maximum value is %s", param), nil
+	}
+
+	return "", nil
+}
+
+// regexpCache holds the compiled regular expressions of the regex rules, which
+// are checked on every request.
+var regexpCache sync.Map
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if compiled, found := regexpCache.Load(expr); found {
+		return compiled.(*regexp.Regexp), nil
+	}
+
+	compiled, err := regexp.Compile(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	regexpCache.Store(expr, compiled)
+	return compiled, nil
+}
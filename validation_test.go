@@ -0,0 +1,205 @@
+package trama
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type contactForm struct {
+	Name    string   `form:"name" validate:"required,min=3,max=10"`
+	Email   string   `form:"email" validate:"email"`
+	Age     *int     `form:"age" validate:"min=18,max=120"`
+	Kind    string   `form:"kind" validate:"enum=person|company"`
+	Code    string   `form:"code" validate:"regex=^[A-Z]{2,3}$"`
+	Tags    []string `form:"tag" validate:"max=2"`
+	Domain  string   `form:"domain" validate:"domain"`
+	Comment string
+}
+
+func TestValidator(t *testing.T) {
+	age := func(n int) *int { return &n }
+
+	data := []struct {
+		description    string
+		target         contactForm
+		expectedErrors ValidationErrors
+	}{
+		{
+			description: "It should accept valid fields",
+			target: contactForm{
+				Name:   "Drummond",
+				Email:  "carlos@drummond.com.br",
+				Age:    age(30),
+				Kind:   "person",
+				Code:   "MG",
+				Tags:   []string{"poeta"},
+				Domain: "drummond.com.br",
+			},
+		},
+		{
+			description: "It should accept empty optional fields",
+			target:      contactForm{Name: "Drummond"},
+		},
+		{
+			description: "It should report the broken rules",
+			target: contactForm{
+				Email:  "carlos",
+				Age:    age(12),
+				Kind:   "poet",
+				Code:   "mg",
+				Tags:   []string{"poeta", "cronista", "contista"},
+				Domain: "drummond",
+			},
+			expectedErrors: ValidationErrors{
+				{Field: "name", Rule: "required", Message: "This field is required"},
+				{Field: "email", Rule: "email", Message: "Invalid email address"},
+				{Field: "age", Rule: "min", Message: "The minimum value is 18"},
+				{Field: "kind", Rule: "enum", Message: "The value must be one of: person, company"},
+				{Field: "code", Rule: "regex", Message: "The value doesn’t have the expected format"},
+				{Field: "tag", Rule: "max", Message: "The maximum length is 2"},
+				{Field: "domain", Rule: "domain", Message: "Invalid domain"},
+			},
+		},
+		{
+			description: "It should check the bounds of a zero number",
+			target:      contactForm{Name: "Drummond", Age: age(0)},
+			expectedErrors: ValidationErrors{
+				{Field: "age", Rule: "min", Message: "The minimum value is 18"},
+			},
+		},
+		{
+			description: "It should count the characters of strings",
+			target:      contactForm{Name: "Conceição da Ó"},
+			expectedErrors: ValidationErrors{
+				{Field: "name", Rule: "max", Message: "The maximum length is 10"},
+			},
+		},
+	}
+
+	for i, item := range data {
+		target := &validatedHandler{validatedFormHandler: validatedFormHandler{contactForm: item.target}}
+		validator := NewValidator(target)
+		validator.Funcs = map[string]ValidationFunc{
+			"domain": func(value interface{}) error {
+				if domain := value.(string); domain != "" && !strings.Contains(domain, ".") {
+					return errors.New("Invalid domain")
+				}
+
+				return nil
+			},
+		}
+
+		r := httptest.NewRequest("POST", "/", nil)
+
+		if err := validator.Before(nil, r); err != nil {
+			t.Errorf("Item %d, “%s”, unexpected error: “%s”", i, item.description, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(target.errs, item.expectedErrors) {
+			t.Errorf("Item %d, “%s”, wrong errors. Expecting “%v”; found “%v”", i, item.description, item.expectedErrors, target.errs)
+		}
+	}
+}
+
+func TestValidatorInterceptor(t *testing.T) {
+	data := []struct {
+		description    string
+		handler        Handler
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "It should call the handler when the fields are valid",
+			handler:        &validatedFormHandler{},
+			body:           "name=Drummond",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "It should reject invalid fields with 422",
+			handler:        &validatedFormHandler{},
+			body:           "name=Drummond&email=carlos",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `"detail":"email: Invalid email address"`,
+		},
+		{
+			description:    "It should pass the errors to a handler implementing ValidationErrorsSetter",
+			handler:        &validatedHandler{},
+			body:           "name=Drummond&email=carlos",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Invalid email address",
+		},
+		{
+			description:    "It should reject unknown rules as a server error",
+			handler:        &unknownRuleHandler{},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for i, item := range data {
+		mux := NewMux()
+		mux.SetLogger(func(error) {})
+		mux.ErrorRenderer = ProblemErrorRenderer{}
+		mux.Register("/", func() Handler { return item.handler })
+
+		r := httptest.NewRequest("POST", "/", strings.NewReader(item.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if body := w.Body.String(); !strings.Contains(body, item.expectedBody) {
+			t.Errorf("Item %d, “%s”, wrong body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, body)
+		}
+	}
+}
+
+type validatedFormHandler struct {
+	NopHandler
+	contactForm
+}
+
+func (h *validatedFormHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(NewBinder(h), NewValidator(h))
+}
+
+func (h *validatedFormHandler) Post(res Response, req *http.Request) error {
+	res.Write([]byte("OK"))
+	return nil
+}
+
+type validatedHandler struct {
+	validatedFormHandler
+	errs ValidationErrors
+}
+
+func (h *validatedHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(NewBinder(h), NewValidator(h))
+}
+
+func (h *validatedHandler) SetValidationErrors(errs ValidationErrors) {
+	h.errs = errs
+}
+
+func (h *validatedHandler) Post(res Response, req *http.Request) error {
+	res.Write([]byte(h.errs.Message("email")))
+	return nil
+}
+
+type unknownRuleHandler struct {
+	NopHandler
+	Name string `validate:"unknown"`
+}
+
+func (h *unknownRuleHandler) Interceptors() InterceptorChain {
+	return NewInterceptorChain(NewValidator(h))
+}
@@ -0,0 +1,112 @@
+package trama
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watch turns on the development mode, in which the template files are
+// checked for changes every interval. When a file changes, the
+// TemplateGroupSets of the handlers using it are parsed again and replaced at
+// once, so that template edits are visible without restarting the server. If
+// the new templates can’t be parsed, the handler answers with a page showing
+// the error until the files are fixed. Watch must be called after
+// ParseTemplates and returns a function that turns the development mode off.
+// Files read from a TemplateGroup’s FS are only watched if it reports their
+// modification times, as the one returned by os.DirFS does.
+func (t *Mux) Watch(interval time.Duration) (stop func()) {
+	t.mutex.RLock()
+	watched := make(map[*adapter]*watchedFiles, len(t.handlers))
+
+	for _, h := range t.handlers {
+		h.mutex.RLock()
+		watched[h] = newWatchedFiles(h.templates)
+		h.mutex.RUnlock()
+	}
+
+	t.mutex.RUnlock()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				t.reloadTemplates(watched)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// reloadTemplates parses again the templates of the handlers whose files
+// changed since the last check.
+func (t *Mux) reloadTemplates(watched map[*adapter]*watchedFiles) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, h := range t.handlers {
+		if files, found := watched[h]; found && !files.changed() {
+			continue
+		}
+
+		set, err := t.parseTemplates(h)
+		h.setTemplates(set, err)
+
+		// The files of the new set are the ones to be watched from now
+		// on, even if it couldn’t be parsed.
+		watched[h] = newWatchedFiles(set)
+	}
+}
+
+// watchedFiles keeps a TemplateGroupSet along with the stamp of the state of
+// its files at the last check. The patterns are expanded again at each check,
+// so that new files matching them are noticed.
+type watchedFiles struct {
+	set   TemplateGroupSet
+	stamp string
+}
+
+func newWatchedFiles(set TemplateGroupSet) *watchedFiles {
+	return &watchedFiles{set: set, stamp: stampFiles(set.files())}
+}
+
+// changed checks whether any of the files changed since the last check.
+func (w *watchedFiles) changed() bool {
+	stamp := stampFiles(w.set.files())
+
+	if stamp == w.stamp {
+		return false
+	}
+
+	w.stamp = stamp
+	return true
+}
+
+// stampFiles describes the current state of the files, so that any change in
+// them results in a different stamp.
+func stampFiles(files []TemplateFile) string {
+	stamps := make([]string, len(files))
+
+	for i, file := range files {
+		info, err := file.stat()
+
+		if err != nil {
+			stamps[i] = fmt.Sprintf("%s:%s", file.Name, err)
+		} else {
+			stamps[i] = fmt.Sprintf("%s:%d:%d", file.Name, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+
+	sort.Strings(stamps)
+	return strings.Join(stamps, "\n")
+}
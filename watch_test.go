@@ -0,0 +1,119 @@
+package trama
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trama-watch")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "poema.html")
+
+	data := []struct {
+		description    string
+		content        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "It should render the edited template",
+			content:        "Um galo sozinho não tece uma manhã",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Um galo sozinho não tece uma manhã",
+		},
+		{
+			description:    "It should show the parse error",
+			content:        "ele precisará sempre de outros {{.Galos",
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Error parsing the templates",
+		},
+		{
+			description:    "It should render the fixed template",
+			content:        "ele precisará sempre de outros galos",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ele precisará sempre de outros galos",
+		},
+	}
+
+	if err := ioutil.WriteFile(file, []byte("Tecendo a manhã"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := NewMux()
+	mux.SetLogger(func(error) {})
+	mux.Register("/poema", func() Handler { return &fileHandler{file: file} })
+
+	if err := mux.ParseTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := mux.Watch(5 * time.Millisecond)
+	defer stop()
+
+	for i, item := range data {
+		if err := ioutil.WriteFile(file, []byte(item.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Make sure the modification time changes, even with a coarse
+		// file system clock.
+		modTime := time.Now().Add(time.Duration(i+1) * time.Second)
+
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		var w *httptest.ResponseRecorder
+
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			r, err := http.NewRequest("GET", "/poema", nil)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code == item.expectedStatus && strings.Contains(w.Body.String(), item.expectedBody) {
+				break
+			}
+		}
+
+		if w.Code != item.expectedStatus {
+			t.Errorf("Item %d, “%s”, wrong status code. Expecting %d; found %d", i, item.description, item.expectedStatus, w.Code)
+		}
+
+		if !strings.Contains(w.Body.String(), item.expectedBody) {
+			t.Errorf("Item %d, “%s”, unexpected body. Expecting “%s”; found “%s”", i, item.description, item.expectedBody, w.Body.String())
+		}
+	}
+}
+
+type fileHandler struct {
+	NopHandler
+	file string
+}
+
+func (h *fileHandler) Get(res Response, req *http.Request) error {
+	res.ExecuteTemplate(h.file, nil)
+	return nil
+}
+
+func (h *fileHandler) Templates() TemplateGroupSet {
+	set := NewTemplateGroupSet(nil)
+	set.Insert(TemplateGroup{Files: []string{h.file}})
+	return set
+}